@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 
 	"os"
 
 	"github.com/OZIOisgood/gamma/internal/api"
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/db"
 	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/keys"
 	"github.com/OZIOisgood/gamma/internal/tools"
 	"github.com/fatih/color"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -20,6 +24,12 @@ func main() {
 
 	dbURL := tools.GetEnv("DB_URL")
 
+	// Seals content keys; never fall back to a well-known key
+	tools.GetEnv("MASTER_KEY")
+	if err := keys.CheckMasterKey(); err != nil {
+		log.Fatalf("Invalid master key: %v", err)
+	}
+
 	ctx := context.Background()
 	pool, err := pgxpool.New(ctx, dbURL)
 	if err != nil {
@@ -27,6 +37,12 @@ func main() {
 	}
 	defer pool.Close()
 
+	// Seed the first admin from the legacy single-user login
+	err = auth.EnsureBootstrapAdmin(ctx, db.New(pool), os.Getenv("DASHBOARD_USER"), os.Getenv("DASHBOARD_PASSWORD"))
+	if err != nil {
+		log.Fatalf("Unable to create bootstrap admin: %v", err)
+	}
+
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
 		natsURL = "nats://localhost:4222"
@@ -40,6 +56,16 @@ func main() {
 
 	srv := api.NewServer(pool, eventBus)
 
+	// expvar metrics, on their own port so they are not public
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go func() {
+			log.Printf("Serving metrics on %s/debug/vars", addr)
+			if err := http.ListenAndServe(addr, expvar.Handler()); err != nil {
+				log.Printf("Metrics server failed: %v", err)
+			}
+		}()
+	}
+
 	log.Println("Gamma API listening on :8080")
 	if err := http.ListenAndServe(":8080", srv.Router); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/orgs"
+	"github.com/OZIOisgood/gamma/internal/reconcile"
+	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const usage = `Usage: gamma <command> [flags]
+
+Commands:
+  reconcile    Compare S3 with the database and re-enqueue missed jobs
+  org export   Export an organization's records and objects to a directory
+  org purge    Delete an organization with all of its records and objects
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	tools.LoadEnv()
+
+	switch os.Args[1] {
+	case "reconcile":
+		runReconcile(os.Args[2:])
+	case "org":
+		runOrg(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func runReconcile(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report problems without changing anything")
+	gracePeriod := fs.Duration("grace-period", reconcile.DefaultGracePeriod, "how long a pending upload's object may exist before it is re-enqueued")
+	stuckAfter := fs.Duration("stuck-after", reconcile.DefaultStuckAfter, "how long an upload may stay in processing before it is flagged as failed")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, tools.GetEnv("DB_URL"))
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	eventBus, err := events.NewEventBus(natsURL)
+	if err != nil {
+		log.Fatalf("Unable to connect to NATS: %v", err)
+	}
+	defer eventBus.Close()
+
+	if err := eventBus.EnsureStream("GAMMA_MINIO", []string{"gamma.minio.>"}); err != nil {
+		log.Fatalf("Failed to ensure NATS stream: %v", err)
+	}
+	r := reconcile.NewReconciler(pool, storage.New(), eventBus)
+	r.DryRun = *dryRun
+	r.GracePeriod = *gracePeriod
+	r.StuckAfter = *stuckAfter
+
+	report, err := r.Run(ctx)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	if r.DryRun {
+		log.Println("Dry run, no changes were made")
+	}
+	report.Log()
+}
+
+func runOrg(args []string) {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("org "+args[0], flag.ExitOnError)
+	slug := fs.String("org", "", "slug of the organization")
+	out := fs.String("out", "", "directory to export to (export only)")
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting it (purge only)")
+	fs.Parse(args[1:])
+
+	if *slug == "" {
+		log.Fatal("--org is required")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, tools.GetEnv("DB_URL"))
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	queries := db.New(pool)
+	org, err := queries.GetOrganizationBySlug(ctx, *slug)
+	if err != nil {
+		log.Fatalf("Organization %q not found: %v", *slug, err)
+	}
+
+	switch args[0] {
+	case "export":
+		if *out == "" {
+			log.Fatal("--out is required")
+		}
+		report, err := orgs.Export(ctx, queries, storage.New(), org, *out)
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Exported %s to %s: %d uploads, %d assets, %d objects",
+			org.Slug, *out, report.Uploads, report.Assets, report.Objects)
+	case "purge":
+		report, err := orgs.Purge(ctx, queries, storage.New(), org, *dryRun)
+		if err != nil {
+			log.Fatalf("Purge failed: %v", err)
+		}
+		if *dryRun {
+			log.Printf("Dry run, would delete %s: %d uploads, %d assets, %d objects",
+				org.Slug, report.Uploads, report.Assets, report.Objects)
+			return
+		}
+		log.Printf("Purged %s: %d uploads, %d assets, %d objects",
+			org.Slug, report.Uploads, report.Assets, report.Objects)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown org command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/OZIOisgood/gamma/internal/db"
 	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/OZIOisgood/gamma/internal/outbox"
+	"github.com/OZIOisgood/gamma/internal/reconcile"
 	"github.com/OZIOisgood/gamma/internal/storage"
 	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
 	"github.com/OZIOisgood/gamma/internal/worker"
 	"github.com/fatih/color"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -27,6 +32,12 @@ func main() {
 
 	dbURL := tools.GetEnv("DB_URL")
 
+	// Seals content keys; never fall back to a well-known key
+	tools.GetEnv("MASTER_KEY")
+	if err := keys.CheckMasterKey(); err != nil {
+		log.Fatalf("Invalid master key: %v", err)
+	}
+
 	workerName := os.Getenv("WORKER_NAME")
 	if workerName == "" {
 		workerName = "worker-1"
@@ -41,7 +52,6 @@ func main() {
 	}
 	defer pool.Close()
 
-	queries := db.New(pool)
 	store := storage.New()
 
 	eventBus, err := events.NewEventBus(natsURL)
@@ -50,7 +60,14 @@ func main() {
 	}
 	defer eventBus.Close()
 
-	handler := worker.NewHandler(queries, store, eventBus, workerName)
+	handler := worker.NewHandler(pool, store, eventBus, workerName)
+	if v := os.Getenv("HLS_KEY_ROTATION_SEGMENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid HLS_KEY_ROTATION_SEGMENTS: %q", v)
+		}
+		handler.KeyRotation = n
+	}
 
 	// Ensure stream exists for MinIO events
 	// MinIO publishes to subjects like "gamma.minio.uploaded"
@@ -58,12 +75,33 @@ func main() {
 		log.Fatalf("Failed to ensure NATS stream: %v", err)
 	}
 
+	// Streams for the events the outbox relay publishes
+	if err := eventBus.EnsureLifecycleStream(); err != nil {
+		log.Fatalf("Failed to ensure NATS stream: %v", err)
+	}
+	if err := webhooks.EnsureStream(eventBus); err != nil {
+		log.Fatalf("Failed to ensure webhook stream: %v", err)
+	}
+	go outbox.NewRelay(pool, eventBus).Start(ctx)
+
 	// Subscribe to MinIO upload events
-	_, err = eventBus.Subscribe("gamma.minio.uploaded", "transcoding-workers", handler.HandleUploadEvent)
+	_, err = eventBus.Subscribe(worker.UploadEventSubject, "transcoding-workers", handler.HandleUploadEvent)
 	if err != nil {
 		log.Fatalf("Failed to subscribe: %v", err)
 	}
 
+	// Periodically repair uploads whose notification was lost. Only one
+	// worker should have this enabled.
+	if interval := os.Getenv("RECONCILE_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid RECONCILE_INTERVAL: %v", err)
+		}
+		reconciler := reconcile.NewReconciler(pool, store, eventBus)
+		go reconciler.Start(ctx, d)
+		log.Printf("Reconciling every %s", d)
+	}
+
 	log.Println("Worker listening for events...")
 
 	// Wait for interrupt signal
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS uploads_checksum_sha256_idx;
+
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS deduplicate,
+    DROP COLUMN IF EXISTS checksum_sha256;
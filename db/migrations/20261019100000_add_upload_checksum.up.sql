@@ -0,0 +1,5 @@
+ALTER TABLE uploads
+    ADD COLUMN checksum_sha256 TEXT,
+    ADD COLUMN deduplicate BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE INDEX uploads_checksum_sha256_idx ON uploads (checksum_sha256);
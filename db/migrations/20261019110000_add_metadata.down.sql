@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS assets_metadata_idx;
+DROP INDEX IF EXISTS assets_external_id_key;
+DROP INDEX IF EXISTS uploads_external_id_key;
+
+ALTER TABLE assets
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS external_id,
+    DROP COLUMN IF EXISTS creator_id,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS title;
+
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS external_id,
+    DROP COLUMN IF EXISTS creator_id,
+    DROP COLUMN IF EXISTS description;
@@ -0,0 +1,21 @@
+ALTER TABLE uploads
+    ADD COLUMN description TEXT,
+    ADD COLUMN creator_id TEXT,
+    ADD COLUMN external_id TEXT,
+    ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE assets
+    ADD COLUMN title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT,
+    ADD COLUMN creator_id TEXT,
+    ADD COLUMN external_id TEXT,
+    ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+UPDATE assets
+SET title = uploads.title
+FROM uploads
+WHERE uploads.id = assets.upload_id;
+
+CREATE UNIQUE INDEX uploads_external_id_key ON uploads (external_id) WHERE external_id IS NOT NULL;
+CREATE UNIQUE INDEX assets_external_id_key ON assets (external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX assets_metadata_idx ON assets USING GIN (metadata);
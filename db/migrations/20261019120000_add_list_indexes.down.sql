@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS assets_tags_idx;
+DROP INDEX IF EXISTS assets_creator_id_idx;
+DROP INDEX IF EXISTS assets_status_idx;
+DROP INDEX IF EXISTS assets_updated_at_id_idx;
+DROP INDEX IF EXISTS assets_created_at_id_idx;
+
+DROP INDEX IF EXISTS uploads_tags_idx;
+DROP INDEX IF EXISTS uploads_creator_id_idx;
+DROP INDEX IF EXISTS uploads_status_idx;
+DROP INDEX IF EXISTS uploads_updated_at_id_idx;
+DROP INDEX IF EXISTS uploads_created_at_id_idx;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS tags;
+ALTER TABLE uploads DROP COLUMN IF EXISTS tags;
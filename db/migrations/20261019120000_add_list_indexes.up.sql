@@ -0,0 +1,14 @@
+ALTER TABLE uploads ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE assets ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX uploads_created_at_id_idx ON uploads (created_at, id);
+CREATE INDEX uploads_updated_at_id_idx ON uploads (updated_at, id);
+CREATE INDEX uploads_status_idx ON uploads (status);
+CREATE INDEX uploads_creator_id_idx ON uploads (creator_id);
+CREATE INDEX uploads_tags_idx ON uploads USING GIN (tags);
+
+CREATE INDEX assets_created_at_id_idx ON assets (created_at, id);
+CREATE INDEX assets_updated_at_id_idx ON assets (updated_at, id);
+CREATE INDEX assets_status_idx ON assets (status);
+CREATE INDEX assets_creator_id_idx ON assets (creator_id);
+CREATE INDEX assets_tags_idx ON assets USING GIN (tags);
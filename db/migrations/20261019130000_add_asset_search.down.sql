@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS assets_search_refresh ON assets;
+DROP FUNCTION IF EXISTS asset_search_refresh();
+DROP TABLE IF EXISTS asset_search;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS transcript;
@@ -0,0 +1,30 @@
+ALTER TABLE assets ADD COLUMN transcript TEXT;
+
+CREATE TABLE asset_search (
+    asset_id UUID PRIMARY KEY REFERENCES assets(id) ON DELETE CASCADE,
+    document TSVECTOR NOT NULL
+);
+
+CREATE INDEX asset_search_document_idx ON asset_search USING GIN (document);
+
+CREATE FUNCTION asset_search_refresh() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO asset_search (asset_id, document)
+    VALUES (
+        NEW.id,
+        setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.transcript, '')), 'D')
+    )
+    ON CONFLICT (asset_id) DO UPDATE SET document = EXCLUDED.document;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER assets_search_refresh
+AFTER INSERT OR UPDATE OF title, tags, description, transcript ON assets
+FOR EACH ROW EXECUTE FUNCTION asset_search_refresh();
+
+-- Index existing assets
+UPDATE assets SET title = title;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_tokens;
+DROP TYPE IF EXISTS user_token_purpose;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_admin = (role = 'admin');
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+DROP TYPE IF EXISTS user_role;
@@ -0,0 +1,8 @@
+CREATE TYPE user_role AS ENUM ('admin', 'editor', 'viewer', 'uploader');
+
+ALTER TABLE users ADD COLUMN role user_role NOT NULL DEFAULT 'viewer';
+
+UPDATE users
+SET role = CASE WHEN is_admin THEN 'admin'::user_role ELSE 'editor'::user_role END;
+
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN oidc_issuer TEXT;
+ALTER TABLE users ADD COLUMN oidc_subject TEXT;
+
+CREATE UNIQUE INDEX users_oidc_identity_idx ON users (oidc_issuer, oidc_subject)
+    WHERE oidc_subject IS NOT NULL;
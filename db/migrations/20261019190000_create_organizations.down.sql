@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS uploads_external_id_key;
+DROP INDEX IF EXISTS assets_external_id_key;
+CREATE UNIQUE INDEX uploads_external_id_key ON uploads (external_id) WHERE external_id IS NOT NULL;
+CREATE UNIQUE INDEX assets_external_id_key ON assets (external_id) WHERE external_id IS NOT NULL;
+
+DROP INDEX IF EXISTS api_keys_org_id_idx;
+DROP INDEX IF EXISTS assets_org_id_created_at_idx;
+DROP INDEX IF EXISTS uploads_org_id_created_at_idx;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS org_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS org_id;
+ALTER TABLE assets DROP COLUMN IF EXISTS org_id;
+ALTER TABLE uploads DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,48 @@
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX organization_members_user_id_idx ON organization_members (user_id);
+
+-- Existing data and users move to a default organization
+INSERT INTO organizations (id, slug, name)
+VALUES ('00000000-0000-0000-0000-000000000001', 'default', 'Default');
+
+INSERT INTO organization_members (org_id, user_id)
+SELECT '00000000-0000-0000-0000-000000000001', id FROM users;
+
+ALTER TABLE uploads ADD COLUMN org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE uploads ALTER COLUMN org_id DROP DEFAULT;
+
+ALTER TABLE assets ADD COLUMN org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE assets ALTER COLUMN org_id DROP DEFAULT;
+
+ALTER TABLE api_keys ADD COLUMN org_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE api_keys ALTER COLUMN org_id DROP DEFAULT;
+
+-- The organization a session is currently working in
+ALTER TABLE sessions ADD COLUMN org_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+UPDATE sessions SET org_id = '00000000-0000-0000-0000-000000000001';
+
+CREATE INDEX uploads_org_id_created_at_idx ON uploads (org_id, created_at, id);
+CREATE INDEX assets_org_id_created_at_idx ON assets (org_id, created_at, id);
+CREATE INDEX api_keys_org_id_idx ON api_keys (org_id);
+
+-- External IDs only need to be unique within an organization
+DROP INDEX uploads_external_id_key;
+DROP INDEX assets_external_id_key;
+CREATE UNIQUE INDEX uploads_external_id_key ON uploads (org_id, external_id) WHERE external_id IS NOT NULL;
+CREATE UNIQUE INDEX assets_external_id_key ON assets (org_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS uploads_external_id_key;
+DROP INDEX IF EXISTS assets_external_id_key;
+CREATE UNIQUE INDEX uploads_external_id_key ON uploads (org_id, external_id) WHERE external_id IS NOT NULL;
+CREATE UNIQUE INDEX assets_external_id_key ON assets (org_id, external_id) WHERE external_id IS NOT NULL;
+
+DROP INDEX IF EXISTS api_keys_env_id_idx;
+DROP INDEX IF EXISTS assets_env_id_created_at_idx;
+DROP INDEX IF EXISTS uploads_env_id_created_at_idx;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS promoted_from;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS env_id;
+ALTER TABLE assets DROP COLUMN IF EXISTS env_id;
+ALTER TABLE uploads DROP COLUMN IF EXISTS env_id;
+
+DROP TABLE IF EXISTS environments;
@@ -0,0 +1,45 @@
+CREATE TABLE environments (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    settings JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+-- Every organization starts with dev, qa and prod; existing data moves to prod
+INSERT INTO environments (id, org_id, name)
+SELECT gen_random_uuid(), organizations.id, env.name
+FROM organizations
+CROSS JOIN (VALUES ('dev'), ('qa'), ('prod')) AS env(name);
+
+ALTER TABLE uploads ADD COLUMN env_id UUID REFERENCES environments(id) ON DELETE CASCADE;
+UPDATE uploads SET env_id = environments.id
+FROM environments
+WHERE environments.org_id = uploads.org_id AND environments.name = 'prod';
+ALTER TABLE uploads ALTER COLUMN env_id SET NOT NULL;
+
+ALTER TABLE assets ADD COLUMN env_id UUID REFERENCES environments(id) ON DELETE CASCADE;
+UPDATE assets SET env_id = environments.id
+FROM environments
+WHERE environments.org_id = assets.org_id AND environments.name = 'prod';
+ALTER TABLE assets ALTER COLUMN env_id SET NOT NULL;
+
+ALTER TABLE api_keys ADD COLUMN env_id UUID REFERENCES environments(id) ON DELETE CASCADE;
+UPDATE api_keys SET env_id = environments.id
+FROM environments
+WHERE environments.org_id = api_keys.org_id AND environments.name = 'prod';
+ALTER TABLE api_keys ALTER COLUMN env_id SET NOT NULL;
+
+-- The asset a promoted copy was made from
+ALTER TABLE assets ADD COLUMN promoted_from UUID REFERENCES assets(id) ON DELETE SET NULL;
+
+CREATE INDEX uploads_env_id_created_at_idx ON uploads (env_id, created_at, id);
+CREATE INDEX assets_env_id_created_at_idx ON assets (env_id, created_at, id);
+CREATE INDEX api_keys_env_id_idx ON api_keys (env_id);
+
+-- External IDs only need to be unique within an environment
+DROP INDEX uploads_external_id_key;
+DROP INDEX assets_external_id_key;
+CREATE UNIQUE INDEX uploads_external_id_key ON uploads (env_id, external_id) WHERE external_id IS NOT NULL;
+CREATE UNIQUE INDEX assets_external_id_key ON assets (env_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS playback_tokens;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS max_tokens;
+ALTER TABLE assets DROP COLUMN IF EXISTS token_ttl_seconds;
+ALTER TABLE assets DROP COLUMN IF EXISTS allowed_referrers;
+ALTER TABLE assets DROP COLUMN IF EXISTS visibility;
+
+DROP TYPE IF EXISTS asset_visibility;
@@ -0,0 +1,20 @@
+CREATE TYPE asset_visibility AS ENUM ('public', 'unlisted', 'private');
+
+-- unlisted matches signed playback, which every asset used so far
+ALTER TABLE assets ADD COLUMN visibility asset_visibility NOT NULL DEFAULT 'unlisted';
+
+-- Playback policy: referrer domains allowed to embed the asset (empty
+-- allows any), the longest a playback token may live (0 uses the default)
+-- and how many unexpired tokens may exist at once (0 is unlimited)
+ALTER TABLE assets ADD COLUMN allowed_referrers TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE assets ADD COLUMN token_ttl_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE assets ADD COLUMN max_tokens INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE playback_tokens (
+    id UUID PRIMARY KEY,
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX playback_tokens_asset_id_expires_at_idx ON playback_tokens (asset_id, expires_at);
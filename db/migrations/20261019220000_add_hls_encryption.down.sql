@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS asset_keys;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS encrypted;
+ALTER TABLE uploads DROP COLUMN IF EXISTS encrypt;
@@ -0,0 +1,14 @@
+-- Uploads ask for encryption, assets record whether their renditions are
+-- encrypted. Deduplication only reuses renditions with the same setting.
+ALTER TABLE uploads ADD COLUMN encrypt BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE assets ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false;
+
+-- AES-128 content keys of encrypted assets, sealed with the master key.
+-- key_index counts rotations, starting at 0.
+CREATE TABLE asset_keys (
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    key_index INTEGER NOT NULL,
+    sealed_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (asset_id, key_index)
+);
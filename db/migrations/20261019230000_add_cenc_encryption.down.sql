@@ -0,0 +1,4 @@
+ALTER TABLE asset_keys DROP COLUMN IF EXISTS key_id;
+
+ALTER TABLE assets DROP COLUMN IF EXISTS drm_scheme;
+ALTER TABLE uploads DROP COLUMN IF EXISTS drm_scheme;
@@ -0,0 +1,8 @@
+-- CMAF renditions encrypted with Common Encryption instead of AES-128
+-- TS. Assets with a scheme are also marked encrypted.
+ALTER TABLE uploads ADD COLUMN drm_scheme TEXT CHECK (drm_scheme IN ('cenc', 'cbcs'));
+ALTER TABLE assets ADD COLUMN drm_scheme TEXT CHECK (drm_scheme IN ('cenc', 'cbcs'));
+
+-- Key ID of CENC content keys, announced in the manifests and requested
+-- in Clear Key license requests
+ALTER TABLE asset_keys ADD COLUMN key_id BYTEA;
@@ -0,0 +1,41 @@
+CREATE TABLE webhook_endpoints (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    env_id UUID NOT NULL REFERENCES environments(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- Signs deliveries, so it is kept readable
+    secret TEXT NOT NULL,
+    -- Event types delivered to the endpoint, empty for all
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    description TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_endpoints_org_id_env_id_idx ON webhook_endpoints (org_id, env_id);
+
+CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    endpoint_id UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status webhook_delivery_status NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ,
+    -- Set on deliveries created by the redeliver endpoint
+    redelivery_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+-- An event is dispatched to an endpoint once, however often the
+-- dispatcher sees it
+CREATE UNIQUE INDEX webhook_deliveries_endpoint_id_event_id_idx ON webhook_deliveries (endpoint_id, event_id)
+    WHERE redelivery_of IS NULL;
+CREATE INDEX webhook_deliveries_endpoint_id_created_at_idx ON webhook_deliveries (endpoint_id, created_at DESC);
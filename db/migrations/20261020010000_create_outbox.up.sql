@@ -0,0 +1,13 @@
+-- Messages written in the same transaction as the state they describe and
+-- published to NATS by the relay afterwards
+CREATE TABLE outbox (
+    id UUID PRIMARY KEY,
+    subject TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox (created_at) WHERE published_at IS NULL;
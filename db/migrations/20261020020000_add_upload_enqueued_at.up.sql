@@ -0,0 +1 @@
+ALTER TABLE uploads ADD COLUMN enqueued_at TIMESTAMPTZ;
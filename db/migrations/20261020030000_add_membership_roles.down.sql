@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN role user_role NOT NULL DEFAULT 'viewer';
+
+-- Users get their most privileged membership role back
+UPDATE users
+SET role = m.role
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, role
+    FROM organization_members
+    ORDER BY user_id, CASE role
+        WHEN 'admin' THEN 0
+        WHEN 'editor' THEN 1
+        WHEN 'uploader' THEN 2
+        ELSE 3
+    END
+) AS m
+WHERE m.user_id = users.id;
+
+ALTER TABLE organization_members DROP COLUMN role;
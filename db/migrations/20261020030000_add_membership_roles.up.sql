@@ -0,0 +1,9 @@
+-- Roles apply per organization
+ALTER TABLE organization_members ADD COLUMN role user_role NOT NULL DEFAULT 'viewer';
+
+UPDATE organization_members
+SET role = users.role
+FROM users
+WHERE users.id = organization_members.user_id;
+
+ALTER TABLE users DROP COLUMN role;
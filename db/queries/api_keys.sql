@@ -0,0 +1,28 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys (id, org_id, env_id, name, prefix, secret_hash, scopes, created_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetApiKey :one
+SELECT * FROM api_keys
+WHERE id = $1 LIMIT 1;
+
+-- name: GetApiKeyByPrefix :one
+SELECT * FROM api_keys
+WHERE prefix = $1 LIMIT 1;
+
+-- name: ListApiKeys :many
+SELECT * FROM api_keys
+WHERE org_id = $1 AND env_id = $2
+ORDER BY created_at DESC;
+
+-- name: RevokeApiKey :one
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND org_id = $2 AND env_id = $3 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: TouchApiKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,18 @@
+-- name: CreateAssetKey :exec
+INSERT INTO asset_keys (asset_id, key_index, sealed_key, key_id)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetAssetKey :one
+SELECT * FROM asset_keys
+WHERE asset_id = $1 AND key_index = $2 LIMIT 1;
+
+-- name: CopyAssetKeys :exec
+INSERT INTO asset_keys (asset_id, key_index, sealed_key, key_id)
+SELECT sqlc.arg('asset_id')::uuid, key_index, sealed_key, key_id
+FROM asset_keys
+WHERE asset_keys.asset_id = sqlc.arg('source_id');
+
+-- name: ListAssetKeys :many
+SELECT * FROM asset_keys
+WHERE asset_id = $1
+ORDER BY key_index;
@@ -1,15 +1,22 @@
 -- name: CreateAsset :one
-INSERT INTO assets (id, upload_id, hls_root, status)
-VALUES ($1, $2, $3, $4)
+INSERT INTO assets (id, org_id, env_id, upload_id, hls_root, status, title, description, creator_id, external_id, metadata, tags, encrypted, drm_scheme)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+RETURNING *;
+
+-- name: CopyAsset :one
+INSERT INTO assets (id, org_id, env_id, upload_id, hls_root, status, title, description, creator_id, external_id, metadata, tags, transcript, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme)
+SELECT sqlc.arg('id')::uuid, org_id, sqlc.arg('env_id')::uuid, upload_id, sqlc.arg('hls_root')::text, status, title, description, creator_id, external_id, metadata, tags, transcript, id, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
+FROM assets
+WHERE assets.id = sqlc.arg('source_id')
 RETURNING *;
 
 -- name: GetAsset :one
 SELECT * FROM assets
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1;
 
 -- name: GetAssetByUploadID :one
 SELECT * FROM assets
-WHERE upload_id = $1 LIMIT 1;
+WHERE upload_id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1;
 
 -- name: UpdateAssetStatus :one
 UPDATE assets
@@ -17,6 +24,115 @@ SET status = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
+-- name: GetReadyAsset :one
+SELECT * FROM assets
+WHERE id = $1 AND status = 'ready' LIMIT 1;
+
+-- name: ListPublicAssetRoots :many
+SELECT hls_root FROM assets
+GROUP BY hls_root
+HAVING bool_and(visibility = 'public') AND bool_or(status = 'ready')
+ORDER BY hls_root;
+
+-- name: IsHlsRootPublic :one
+SELECT NOT EXISTS (
+    SELECT 1 FROM assets
+    WHERE hls_root = $1 AND visibility <> 'public'
+) AS public;
+
 -- name: ListAssets :many
 SELECT * FROM assets
 ORDER BY created_at DESC;
+
+-- name: GetReadyAssetByChecksum :one
+SELECT assets.* FROM assets
+JOIN uploads ON uploads.id = assets.upload_id
+WHERE assets.org_id = $1 AND assets.env_id = $2 AND uploads.checksum_sha256 = $3 AND assets.encrypted = $4
+    AND assets.drm_scheme IS NOT DISTINCT FROM $5 AND assets.visibility = $6 AND assets.status = 'ready'
+ORDER BY assets.created_at
+LIMIT 1;
+
+-- name: GetAssetByExternalID :one
+SELECT * FROM assets
+WHERE org_id = $1 AND env_id = $2 AND external_id = $3 LIMIT 1;
+
+-- name: UpdateAssetMetadata :one
+UPDATE assets
+SET title = COALESCE(sqlc.narg('title'), title),
+    description = CASE WHEN sqlc.arg('set_description')::boolean THEN sqlc.narg('description') ELSE description END,
+    creator_id = CASE WHEN sqlc.arg('set_creator_id')::boolean THEN sqlc.narg('creator_id') ELSE creator_id END,
+    external_id = CASE WHEN sqlc.arg('set_external_id')::boolean THEN sqlc.narg('external_id') ELSE external_id END,
+    metadata = COALESCE(sqlc.narg('metadata'), metadata),
+    tags = CASE WHEN sqlc.arg('set_tags')::boolean THEN COALESCE(sqlc.narg('tags')::text[], '{}') ELSE tags END,
+    transcript = CASE WHEN sqlc.arg('set_transcript')::boolean THEN sqlc.narg('transcript') ELSE transcript END,
+    visibility = COALESCE(sqlc.narg('visibility')::asset_visibility, visibility),
+    allowed_referrers = CASE WHEN sqlc.arg('set_allowed_referrers')::boolean THEN COALESCE(sqlc.narg('allowed_referrers')::text[], '{}') ELSE allowed_referrers END,
+    token_ttl_seconds = CASE WHEN sqlc.arg('set_token_ttl_seconds')::boolean THEN COALESCE(sqlc.narg('token_ttl_seconds')::integer, 0) ELSE token_ttl_seconds END,
+    max_tokens = CASE WHEN sqlc.arg('set_max_tokens')::boolean THEN COALESCE(sqlc.narg('max_tokens')::integer, 0) ELSE max_tokens END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND org_id = sqlc.arg('org_id') AND env_id = sqlc.arg('env_id')
+RETURNING *;
+
+-- name: ListAssetsPage :many
+SELECT * FROM assets
+WHERE org_id = sqlc.arg('org_id')
+    AND env_id = sqlc.arg('env_id')
+    AND (sqlc.narg('status')::asset_status IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+    AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+    AND (sqlc.narg('creator_id')::text IS NULL OR creator_id = sqlc.narg('creator_id'))
+    AND (sqlc.narg('tag')::text IS NULL OR tags @> ARRAY[sqlc.narg('tag')::text])
+    AND metadata @> sqlc.arg('metadata')
+    AND metadata ?& sqlc.arg('keys')::text[]
+    AND (
+        sqlc.narg('cursor_time')::timestamptz IS NULL
+        OR (sqlc.arg('sort_desc')::boolean
+            AND (CASE WHEN sqlc.arg('sort_by')::text = 'updated_at' THEN updated_at ELSE created_at END, id) < (sqlc.narg('cursor_time'), sqlc.narg('cursor_id')::uuid))
+        OR (NOT sqlc.arg('sort_desc')
+            AND (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END, id) > (sqlc.narg('cursor_time'), sqlc.narg('cursor_id')))
+    )
+ORDER BY
+    CASE WHEN sqlc.arg('sort_desc') THEN (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END) END DESC,
+    CASE WHEN sqlc.arg('sort_desc') THEN id END DESC,
+    CASE WHEN NOT sqlc.arg('sort_desc') THEN (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END) END ASC,
+    CASE WHEN NOT sqlc.arg('sort_desc') THEN id END ASC
+LIMIT sqlc.arg('limit');
+
+-- name: CountAssets :one
+SELECT COUNT(*) FROM assets
+WHERE org_id = sqlc.arg('org_id')
+    AND env_id = sqlc.arg('env_id')
+    AND (sqlc.narg('status')::asset_status IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+    AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+    AND (sqlc.narg('creator_id')::text IS NULL OR creator_id = sqlc.narg('creator_id'))
+    AND (sqlc.narg('tag')::text IS NULL OR tags @> ARRAY[sqlc.narg('tag')::text])
+    AND metadata @> sqlc.arg('metadata')
+    AND metadata ?& sqlc.arg('keys')::text[];
+
+-- name: SearchAssets :many
+SELECT sqlc.embed(assets),
+    ts_rank_cd(asset_search.document, to_tsquery('simple', sqlc.arg('query'))) AS rank,
+    ts_headline('simple', translate(assets.title, U&'\E000\E001', ''), to_tsquery('simple', sqlc.arg('query')), U&'StartSel="\E000", StopSel="\E001", HighlightAll=true') AS title_highlight,
+    ts_headline('simple', translate(coalesce(assets.description, '') || ' ' || coalesce(assets.transcript, ''), U&'\E000\E001', ''), to_tsquery('simple', sqlc.arg('query')), U&'StartSel="\E000", StopSel="\E001", MaxFragments=2') AS snippet
+FROM assets
+JOIN asset_search ON asset_search.asset_id = assets.id
+WHERE assets.org_id = sqlc.arg('org_id')
+    AND assets.env_id = sqlc.arg('env_id')
+    AND asset_search.document @@ to_tsquery('simple', sqlc.arg('query'))
+ORDER BY rank DESC, assets.created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: ListAssetsByOrg :many
+SELECT * FROM assets
+WHERE org_id = $1
+ORDER BY created_at;
+
+-- name: DeleteAsset :one
+DELETE FROM assets
+WHERE id = $1 AND org_id = $2 AND env_id = $3
+RETURNING *;
+
+-- name: CountAssetsByHlsRoot :one
+SELECT COUNT(*) FROM assets
+WHERE hls_root = $1;
@@ -0,0 +1,10 @@
+-- name: CreateAuditLog :exec
+INSERT INTO audit_log (user_id, api_key_id, action, resource_type, resource_id)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListAuditLogByApiKey :many
+SELECT audit_log.* FROM audit_log
+JOIN api_keys ON api_keys.id = audit_log.api_key_id
+WHERE audit_log.api_key_id = $1 AND api_keys.org_id = $2
+ORDER BY audit_log.created_at DESC
+LIMIT $3;
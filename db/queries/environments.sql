@@ -0,0 +1,23 @@
+-- name: CreateEnvironment :one
+INSERT INTO environments (id, org_id, name)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetEnvironment :one
+SELECT * FROM environments
+WHERE id = $1 LIMIT 1;
+
+-- name: GetEnvironmentByName :one
+SELECT * FROM environments
+WHERE org_id = $1 AND name = $2 LIMIT 1;
+
+-- name: ListEnvironments :many
+SELECT * FROM environments
+WHERE org_id = $1
+ORDER BY created_at, name;
+
+-- name: UpdateEnvironmentSettings :one
+UPDATE environments
+SET settings = $3
+WHERE id = $1 AND org_id = $2
+RETURNING *;
@@ -0,0 +1,62 @@
+-- name: CreateOrganization :one
+INSERT INTO organizations (id, slug, name)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetOrganization :one
+SELECT * FROM organizations
+WHERE id = $1 LIMIT 1;
+
+-- name: GetOrganizationBySlug :one
+SELECT * FROM organizations
+WHERE slug = $1 LIMIT 1;
+
+-- name: ListOrganizations :many
+SELECT * FROM organizations
+ORDER BY created_at;
+
+-- name: ListUserOrganizations :many
+SELECT organizations.* FROM organizations
+JOIN organization_members ON organization_members.org_id = organizations.id
+WHERE organization_members.user_id = $1
+ORDER BY organization_members.created_at;
+
+-- name: DeleteOrganization :exec
+DELETE FROM organizations
+WHERE id = $1;
+
+-- name: AddOrganizationMember :exec
+INSERT INTO organization_members (org_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: GetOrganizationMember :one
+SELECT * FROM organization_members
+WHERE org_id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: ListUserMemberships :many
+SELECT * FROM organization_members
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: SetOrganizationMemberRole :one
+UPDATE organization_members
+SET role = $3
+WHERE org_id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: RemoveOrganizationMember :exec
+DELETE FROM organization_members
+WHERE org_id = $1 AND user_id = $2;
+
+-- name: IsOrganizationMember :one
+SELECT EXISTS (
+    SELECT 1 FROM organization_members
+    WHERE org_id = $1 AND user_id = $2
+);
+
+-- name: ListOrganizationMembers :many
+SELECT sqlc.embed(users), organization_members.role FROM users
+JOIN organization_members ON organization_members.user_id = users.id
+WHERE organization_members.org_id = $1
+ORDER BY users.username;
@@ -0,0 +1,24 @@
+-- name: CreateOutboxMessage :exec
+INSERT INTO outbox (id, subject, payload)
+VALUES ($1, $2, $3);
+
+-- name: ClaimOutboxMessages :many
+SELECT * FROM outbox
+WHERE published_at IS NULL
+ORDER BY created_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxMessagePublished :exec
+UPDATE outbox
+SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+WHERE id = $1;
+
+-- name: RecordOutboxFailure :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2
+WHERE id = $1;
+
+-- name: DeletePublishedOutboxMessages :execrows
+DELETE FROM outbox
+WHERE published_at < $1;
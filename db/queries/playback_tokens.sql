@@ -0,0 +1,17 @@
+-- name: LockAssetForPlaybackTokens :exec
+SELECT id FROM assets
+WHERE id = $1
+FOR NO KEY UPDATE;
+
+-- name: CreatePlaybackToken :execrows
+INSERT INTO playback_tokens (id, asset_id, expires_at)
+SELECT sqlc.arg('id')::uuid, sqlc.arg('asset_id')::uuid, sqlc.arg('expires_at')::timestamptz
+WHERE sqlc.arg('max_tokens')::integer = 0
+    OR (
+        SELECT COUNT(*) FROM playback_tokens
+        WHERE asset_id = sqlc.arg('asset_id') AND expires_at > NOW()
+    ) < sqlc.arg('max_tokens');
+
+-- name: DeleteExpiredPlaybackTokens :exec
+DELETE FROM playback_tokens
+WHERE asset_id = $1 AND expires_at <= NOW();
@@ -0,0 +1,49 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, org_id, user_agent, ip_address, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetActiveSession :one
+SELECT sqlc.embed(sessions), sqlc.embed(users)
+FROM sessions
+JOIN users ON users.id = sessions.user_id
+WHERE sessions.id = $1
+  AND sessions.revoked_at IS NULL
+  AND sessions.expires_at > NOW()
+LIMIT 1;
+
+-- name: ListUserSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = NOW(), expires_at = $2
+WHERE id = $1;
+
+-- name: RevokeSession :one
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+
+-- name: SetSessionOrg :exec
+UPDATE sessions
+SET org_id = $2
+WHERE id = $1;
+
+-- name: ClearSessionOrg :exec
+UPDATE sessions
+SET org_id = NULL
+WHERE user_id = $1 AND org_id = $2;
@@ -1,11 +1,11 @@
 -- name: CreateUpload :one
-INSERT INTO uploads (id, title, s3_key, status)
-VALUES ($1, $2, $3, $4)
+INSERT INTO uploads (id, org_id, env_id, title, s3_key, status, deduplicate, description, creator_id, external_id, metadata, tags, encrypt, drm_scheme)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 RETURNING *;
 
 -- name: GetUpload :one
 SELECT * FROM uploads
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1;
 
 -- name: ListUploads :many
 SELECT * FROM uploads
@@ -16,3 +16,68 @@ UPDATE uploads
 SET status = $2, updated_at = NOW()
 WHERE s3_key = $1
 RETURNING *;
+
+-- name: TransitionUploadStatusByKey :one
+UPDATE uploads
+SET status = sqlc.arg('status'), updated_at = NOW()
+WHERE s3_key = sqlc.arg('s3_key')
+    AND status::text = ANY(sqlc.arg('from_statuses')::text[])
+    AND NOT EXISTS (SELECT 1 FROM assets WHERE assets.upload_id = uploads.id)
+RETURNING *;
+
+-- name: MarkUploadEnqueued :exec
+UPDATE uploads
+SET enqueued_at = NOW()
+WHERE id = $1;
+
+-- name: GetUploadByKey :one
+SELECT * FROM uploads
+WHERE s3_key = $1 LIMIT 1;
+
+-- name: ListStuckUploads :many
+SELECT * FROM uploads
+WHERE status = 'processing' AND updated_at < $1
+ORDER BY updated_at;
+
+-- name: SetUploadChecksum :exec
+UPDATE uploads
+SET checksum_sha256 = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListUploadsPage :many
+SELECT * FROM uploads
+WHERE org_id = sqlc.arg('org_id')
+    AND env_id = sqlc.arg('env_id')
+    AND (sqlc.narg('status')::upload_status IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+    AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+    AND (sqlc.narg('creator_id')::text IS NULL OR creator_id = sqlc.narg('creator_id'))
+    AND (sqlc.narg('tag')::text IS NULL OR tags @> ARRAY[sqlc.narg('tag')::text])
+    AND (
+        sqlc.narg('cursor_time')::timestamptz IS NULL
+        OR (sqlc.arg('sort_desc')::boolean
+            AND (CASE WHEN sqlc.arg('sort_by')::text = 'updated_at' THEN updated_at ELSE created_at END, id) < (sqlc.narg('cursor_time'), sqlc.narg('cursor_id')::uuid))
+        OR (NOT sqlc.arg('sort_desc')
+            AND (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END, id) > (sqlc.narg('cursor_time'), sqlc.narg('cursor_id')))
+    )
+ORDER BY
+    CASE WHEN sqlc.arg('sort_desc') THEN (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END) END DESC,
+    CASE WHEN sqlc.arg('sort_desc') THEN id END DESC,
+    CASE WHEN NOT sqlc.arg('sort_desc') THEN (CASE WHEN sqlc.arg('sort_by') = 'updated_at' THEN updated_at ELSE created_at END) END ASC,
+    CASE WHEN NOT sqlc.arg('sort_desc') THEN id END ASC
+LIMIT sqlc.arg('limit');
+
+-- name: CountUploads :one
+SELECT COUNT(*) FROM uploads
+WHERE org_id = sqlc.arg('org_id')
+    AND env_id = sqlc.arg('env_id')
+    AND (sqlc.narg('status')::upload_status IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+    AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+    AND (sqlc.narg('creator_id')::text IS NULL OR creator_id = sqlc.narg('creator_id'))
+    AND (sqlc.narg('tag')::text IS NULL OR tags @> ARRAY[sqlc.narg('tag')::text]);
+
+-- name: ListUploadsByOrg :many
+SELECT * FROM uploads
+WHERE org_id = $1
+ORDER BY created_at;
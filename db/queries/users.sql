@@ -0,0 +1,60 @@
+-- name: CreateUser :one
+INSERT INTO users (id, username, email, name, password_hash)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE username = $1 LIMIT 1;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users;
+
+-- name: SetUserDisabled :one
+UPDATE users
+SET disabled = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: CreateUserToken :exec
+INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: ConsumeUserToken :one
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeUserTokens :exec
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: CreateOidcUser :one
+INSERT INTO users (id, username, email, name, oidc_issuer, oidc_subject)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetUserByOidcSubject :one
+SELECT * FROM users
+WHERE oidc_issuer = $1 AND oidc_subject = $2 LIMIT 1;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1 LIMIT 1;
+
+-- name: LinkUserOidc :one
+UPDATE users
+SET oidc_issuer = $2, oidc_subject = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
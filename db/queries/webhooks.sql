@@ -0,0 +1,60 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, org_id, env_id, url, secret, event_types, description, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE org_id = $1 AND env_id = $2
+ORDER BY created_at;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1;
+
+-- name: GetWebhookEndpointByID :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 LIMIT 1;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND org_id = $2 AND env_id = $3;
+
+-- name: ListWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints
+WHERE org_id = sqlc.arg('org_id') AND env_id = sqlc.arg('env_id')
+    AND (cardinality(event_types) = 0 OR sqlc.arg('event_type')::text = ANY(event_types))
+ORDER BY created_at;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, redelivery_of)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (endpoint_id, event_id) WHERE redelivery_of IS NULL
+DO UPDATE SET updated_at = webhook_deliveries.updated_at
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 LIMIT 1;
+
+-- name: GetWebhookDeliveryForEndpoint :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2 LIMIT 1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RecordWebhookAttempt :one
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = attempts + 1,
+    response_status = $3,
+    last_error = $4,
+    next_attempt_at = $5,
+    delivered_at = CASE WHEN $2 = 'succeeded'::webhook_delivery_status THEN NOW() END,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
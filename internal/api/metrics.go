@@ -0,0 +1,13 @@
+package api
+
+import "expvar"
+
+// hubMetrics are published with expvar under "gamma_hub":
+//
+//   - clients: connected WebSocket and SSE clients
+//   - events_received: events handed to the hub
+//   - events_dropped: events dropped because the hub fell behind
+//   - messages_dropped: events dropped for drop_oldest clients that fell behind
+//   - clients_disconnected: disconnect clients dropped for falling behind
+//   - write_timeouts: connections closed because a write timed out
+var hubMetrics = expvar.NewMap("gamma_hub")
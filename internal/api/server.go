@@ -9,14 +9,21 @@ import (
 	"github.com/OZIOisgood/gamma/internal/auth"
 	"github.com/OZIOisgood/gamma/internal/db"
 	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/outbox"
+	"github.com/OZIOisgood/gamma/internal/playback"
+	"github.com/OZIOisgood/gamma/internal/search"
 	"github.com/OZIOisgood/gamma/internal/storage"
 	"github.com/OZIOisgood/gamma/internal/uploads"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// allowedOrigins may call the API from a browser, including WebSockets.
+var allowedOrigins = []string{"http://localhost:4200", "http://localhost:3000"}
+
 type Server struct {
 	Router   *chi.Mux
 	Pool     *pgxpool.Pool
@@ -29,11 +36,12 @@ func NewServer(pool *pgxpool.Pool, eventBus *events.EventBus) *Server {
 		Router:   chi.NewRouter(),
 		Pool:     pool,
 		EventBus: eventBus,
-		Hub:      NewHub(),
+		Hub:      NewHub(eventBus),
 	}
 	go s.Hub.Run()
 	s.subscribeToEvents()
 	s.routes()
+	go outbox.NewRelay(pool, eventBus).Start(context.Background())
 	return s
 }
 
@@ -43,28 +51,59 @@ func (s *Server) routes() {
 	s.Router.Use(middleware.StripSlashes)
 
 	s.Router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:4200", "http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Gamma-Environment", "Last-Event-ID"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count", "X-Next-Cursor", "X-CSRF-Token", "X-Gamma-Environment"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	s.Router.Post("/auth/login", auth.Login)
-	s.Router.Post("/auth/logout", auth.Logout)
-	s.Router.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
-		ServeWs(s.Hub, w, r)
-	})
-
 	queries := db.New(s.Pool)
+	authHandler := auth.NewHandler(s.Pool)
+
+	oidcConfig, ok, err := auth.OIDCConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid OIDC configuration: %v", err)
+	}
+	if ok {
+		authHandler.OIDC = auth.NewOIDC(queries, oidcConfig)
+		s.Router.Get("/auth/oidc/login", authHandler.OIDC.Login)
+		s.Router.Get("/auth/oidc/callback", authHandler.OIDC.Callback)
+	}
+
+	s.Router.Get("/auth/providers", authHandler.Providers)
+	s.Router.Post("/auth/login", authHandler.Login)
+	s.Router.Post("/auth/logout", authHandler.Logout)
+	s.Router.Post("/auth/invite/accept", authHandler.AcceptInvite)
+	s.Router.Post("/auth/password/reset", authHandler.ResetPassword)
+	events.RegisterSchemaRoutes(s.Router)
+
 	storageService := s.initStorage()
 
-	uploadsHandler := uploads.NewHandler(storageService, queries)
+	playbackHandler := playback.NewHandler(storageService, s.Pool)
+	playbackHandler.RegisterRoutes(s.Router)
+	if err := playbackHandler.SyncBucketPolicy(context.Background()); err != nil {
+		log.Printf("Failed to sync bucket policy: %v", err)
+	}
+	uploadsHandler := uploads.NewHandler(storageService, s.Pool, search.NewPostgres(queries), playbackHandler)
+	webhooksHandler := webhooks.NewHandler(queries, s.EventBus)
+	if err := webhooks.NewDispatcher(queries, s.EventBus).Start(); err != nil {
+		log.Printf("Failed to start webhook dispatcher: %v", err)
+	}
 
+	s.Hub.Revalidate = authHandler.Revalidate
 	s.Router.Group(func(r chi.Router) {
-		r.Use(auth.Middleware)
+		r.Use(authHandler.Middleware)
+		authHandler.RegisterRoutes(r)
 		uploadsHandler.RegisterRoutes(r)
+		webhooksHandler.RegisterRoutes(r)
+		r.With(auth.RequireOrg).Get("/ws", func(w http.ResponseWriter, r *http.Request) {
+			ServeWs(s.Hub, w, r)
+		})
+		r.With(auth.RequireOrg).Get("/events", func(w http.ResponseWriter, r *http.Request) {
+			ServeSSE(s.Hub, w, r)
+		})
 	})
 }
 
@@ -74,10 +113,6 @@ func (s *Server) initStorage() *storage.Storage {
 		log.Printf("Failed to ensure bucket exists: %v", err)
 	}
 
-	if err := storageService.EnsureHLSPublicPolicy(context.Background()); err != nil {
-		log.Printf("Failed to ensure HLS public policy: %v", err)
-	}
-
 	// Run notification setup in background
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/events"
+)
+
+// sseHeartbeatInterval is how often an idle event stream receives a
+// comment, so proxies do not close it.
+const sseHeartbeatInterval = 15 * time.Second
+
+// ServeSSE streams the events the hub routes as Server-Sent Events, for
+// clients behind proxies that break WebSocket upgrades. It must be mounted
+// behind auth.Middleware and auth.RequireOrg.
+//
+// The asset_id, upload_id and type query parameters, repeated or comma
+// separated, filter the stream like a WebSocket subscription; without
+// any, every event type is streamed. Each event's id is its streamseq,
+// so EventSource resumes after reconnecting by sending Last-Event-ID.
+// Clients that cannot set the header pass last_event_id instead.
+func ServeSSE(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	drop, err := parseDropPolicy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	req := SubscriptionRequest{
+		Action:    "subscribe",
+		AssetIDs:  queryList(query["asset_id"]),
+		UploadIDs: queryList(query["upload_id"]),
+		Types:     queryList(query["type"]),
+	}
+	if len(req.AssetIDs) == 0 && len(req.UploadIDs) == 0 && len(req.Types) == 0 {
+		req.Types = events.Types
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	if lastEventID != "" {
+		seq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be a stream sequence", http.StatusBadRequest)
+			return
+		}
+		req.ResumeFrom = &seq
+	}
+
+	if err := newSubscription().apply(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keeps nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Each write gets a deadline, so a stalled connection cannot hold the
+	// client open forever
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := write("retry: 5000\n\n"); err != nil {
+		log.Printf("Streaming is not supported: %v", err)
+		return
+	}
+
+	client := newClient(r.Context(), hub, claims, drop)
+	hub.register <- client
+	defer func() {
+		client.cancel()
+		hub.unregister <- client
+	}()
+
+	// As for WebSockets, the replay starts under the same lock as the
+	// subscription, so live events routed with it are sent after it
+	client.mu.Lock()
+	client.sub.apply(req)
+	if req.ResumeFrom != nil {
+		err = client.startReplay(*req.ResumeFrom + 1)
+	}
+	client.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to resume event stream: %v", err)
+		return
+	}
+
+	err = client.pump(sink{
+		event: func(r *route) error {
+			if r.seq != 0 {
+				return write("id: %d\nevent: %s\ndata: %s\n\n", r.seq, r.event.Type, r.message)
+			}
+			return write("event: %s\ndata: %s\n\n", r.event.Type, r.message)
+		},
+		reply: func([]byte) error { return nil },
+		resync: func(message []byte) error {
+			return write("event: resync\ndata: %s\n\n", message)
+		},
+		heartbeat: func() error {
+			return write(": heartbeat\n\n")
+		},
+		heartbeatInterval: sseHeartbeatInterval,
+	})
+	if isTimeout(err) {
+		hubMetrics.Add("write_timeouts", 1)
+	}
+	if err != nil && err != context.Canceled {
+		log.Printf("Event stream closed: %v", err)
+	}
+}
+
+// queryList splits repeated and comma separated query values.
+func queryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
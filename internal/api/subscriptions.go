@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/events"
+)
+
+// maxSubscriptions bounds the IDs and types a single client may subscribe to.
+const maxSubscriptions = 1000
+
+// SubscriptionRequest is a message clients send to change what they
+// receive. Subscribing adds to the current subscription, unsubscribing
+// removes from it.
+type SubscriptionRequest struct {
+	// Action is "subscribe" or "unsubscribe".
+	Action    string   `json:"action"`
+	AssetIDs  []string `json:"asset_ids,omitempty"`
+	UploadIDs []string `json:"upload_ids,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	// ResumeFrom is the streamseq of the last event the client received
+	// before reconnecting. The events after it that match the
+	// subscription are replayed before live delivery continues.
+	ResumeFrom *uint64 `json:"resume_from,omitempty"`
+}
+
+// SubscriptionResponse confirms a SubscriptionRequest with the resulting
+// subscription, or reports why it was rejected.
+type SubscriptionResponse struct {
+	Action    string   `json:"action"`
+	AssetIDs  []string `json:"asset_ids"`
+	UploadIDs []string `json:"upload_ids"`
+	Types     []string `json:"types"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// subscription is what a client receives. An event matches when its type
+// is subscribed, or no types are, and its asset or upload is subscribed,
+// or no IDs are. A client without any subscription receives nothing.
+type subscription struct {
+	assets  map[string]bool
+	uploads map[string]bool
+	types   map[string]bool
+}
+
+func newSubscription() subscription {
+	return subscription{
+		assets:  make(map[string]bool),
+		uploads: make(map[string]bool),
+		types:   make(map[string]bool),
+	}
+}
+
+// apply changes the subscription as req asks.
+func (s subscription) apply(req SubscriptionRequest) error {
+	var set func(map[string]bool, []string)
+	switch req.Action {
+	case "subscribe":
+		if len(s.assets)+len(s.uploads)+len(s.types)+len(req.AssetIDs)+len(req.UploadIDs)+len(req.Types) > maxSubscriptions {
+			return fmt.Errorf("at most %d subscriptions are allowed", maxSubscriptions)
+		}
+		for _, t := range req.Types {
+			if events.Subject(t) == "" {
+				return fmt.Errorf("unknown event type %q", t)
+			}
+		}
+		set = func(m map[string]bool, keys []string) {
+			for _, k := range keys {
+				m[k] = true
+			}
+		}
+	case "unsubscribe":
+		set = func(m map[string]bool, keys []string) {
+			for _, k := range keys {
+				delete(m, k)
+			}
+		}
+	default:
+		return fmt.Errorf("action must be subscribe or unsubscribe")
+	}
+
+	set(s.assets, req.AssetIDs)
+	set(s.uploads, req.UploadIDs)
+	set(s.types, req.Types)
+	return nil
+}
+
+func (s subscription) response(action string) SubscriptionResponse {
+	keys := func(m map[string]bool) []string {
+		out := make([]string, 0, len(m))
+		for k := range m {
+			out = append(out, k)
+		}
+		return out
+	}
+	return SubscriptionResponse{
+		Action:    action,
+		AssetIDs:  keys(s.assets),
+		UploadIDs: keys(s.uploads),
+		Types:     keys(s.types),
+	}
+}
+
+func (s subscription) matches(r *route) bool {
+	if len(s.types) == 0 && len(s.assets) == 0 && len(s.uploads) == 0 {
+		return false
+	}
+	if len(s.types) > 0 && !s.types[r.event.Type] {
+		return false
+	}
+	if len(s.assets) == 0 && len(s.uploads) == 0 {
+		return true
+	}
+	return (r.AssetID != "" && s.assets[r.AssetID]) || (r.UploadID != "" && s.uploads[r.UploadID])
+}
+
+// route is an event prepared for delivery: encoded once, with the
+// attributes clients are matched on.
+type route struct {
+	event   events.CloudEvent
+	message []byte
+	perm    auth.Permission
+	seq     uint64
+
+	OrgID    string `json:"org_id"`
+	EnvID    string `json:"env_id"`
+	AssetID  string `json:"asset_id"`
+	UploadID string `json:"upload_id"`
+}
+
+func newRoute(event events.CloudEvent) (*route, error) {
+	r := &route{event: event, perm: auth.PermAssetsRead, seq: event.StreamSeq}
+	// Every event type carries these fields, see events.UploadData
+	if err := json.Unmarshal(event.Data, r); err != nil {
+		return nil, fmt.Errorf("invalid %s data: %w", event.Type, err)
+	}
+	if r.OrgID == "" {
+		return nil, fmt.Errorf("%s event %s has no org_id", event.Type, event.ID)
+	}
+	if strings.HasPrefix(event.Type, "gamma.upload.") {
+		r.perm = auth.PermUploadsRead
+	}
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	r.message = message
+	return r, nil
+}
+
+// allowed reports whether the principal may see the event: it must belong
+// to their organization, to their environment for API keys, and need a
+// permission they have.
+func allowed(claims *auth.Claims, r *route) bool {
+	if claims.OrgID != r.OrgID {
+		return false
+	}
+	if claims.EnvID != "" && claims.EnvID != r.EnvID {
+		return false
+	}
+	return claims.Can(r.perm)
+}
@@ -1,42 +1,227 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/events"
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	// maxMessageSize bounds the subscription messages clients send.
+	maxMessageSize = 64 * 1024
+
+	// writeWait is the time allowed to write a message to a client.
+	writeWait = 10 * time.Second
+
+	// pongWait is the time allowed to read the next pong from a client.
+	pongWait = 60 * time.Second
+
+	// pingPeriod is how often clients are pinged. It must be less than
+	// pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// sendBuffer is how many events may queue for a client.
+	sendBuffer = 256
+
+	// hubBacklog is how many events may queue for the hub before new ones
+	// are dropped.
+	hubBacklog = 1024
+
+	// revalidatePeriod is how often a connection's session or API key is
+	// checked again, bounding how long a revoked one keeps receiving
+	// events.
+	revalidatePeriod = time.Minute
+)
+
+// dropPolicy decides what happens when a client falls sendBuffer events
+// behind.
+type dropPolicy string
+
+const (
+	// dropDisconnect closes the connection. The client reconnects and
+	// resumes from its last event without losing any.
+	dropDisconnect dropPolicy = "disconnect"
+	// dropOldest discards the client's oldest queued event to make room,
+	// for clients that prefer gaps to reconnecting. The client is sent a
+	// ResyncMessage before its next event.
+	dropOldest dropPolicy = "drop_oldest"
+)
+
+// ResyncMessage tells a client that events were dropped before reaching
+// it. It can resume from the last streamseq it received, or refetch.
+type ResyncMessage struct {
+	// Action is always "resync".
+	Action string `json:"action"`
+	// Dropped is how many events were dropped. Events the hub dropped are
+	// counted for every client, whether they matched its subscription or
+	// not.
+	Dropped int64 `json:"dropped"`
+}
+
+// parseDropPolicy reads the drop_policy query parameter, defaulting to
+// dropDisconnect.
+func parseDropPolicy(r *http.Request) (dropPolicy, error) {
+	switch p := dropPolicy(r.URL.Query().Get("drop_policy")); p {
+	case "":
+		return dropDisconnect, nil
+	case dropDisconnect, dropOldest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("drop_policy must be disconnect or drop_oldest")
+	}
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin accepts the dashboard origins and clients that send no
+// Origin, which browsers always do. Other sites must not open sockets
+// that ride on the user's session cookie.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || slices.Contains(allowedOrigins, origin)
 }
 
-// Client is a middleman between the websocket connection and the hub.
+// Client is a middleman between a WebSocket or SSE connection and the hub.
 type Client struct {
 	hub *Hub
 
-	// The websocket connection.
+	// The websocket connection, nil for SSE.
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages.
-	send chan []byte
+	// Buffered channel of outbound events.
+	send chan *route
+
+	// Replies to subscription requests. Unlike send it is never closed,
+	// so readPump can write to it at any time.
+	replies chan []byte
+
+	// drop applies when send is full.
+	drop dropPolicy
+
+	// mu guards claims and sub. claims of the principal that opened the
+	// connection are refreshed every revalidatePeriod, so role changes
+	// apply to open connections too.
+	mu     sync.Mutex
+	claims *auth.Claims
+	sub    subscription
+
+	// resume hands a replay to writePump, which sends it before any later
+	// event. resuming is set while a replay runs.
+	resume   chan chan *route
+	resuming bool
+
+	// dropped counts the events dropped since the last ResyncMessage, and
+	// resync wakes pump to send one.
+	dropped atomic.Int64
+	resync  chan struct{}
+
+	// ctx is cancelled once the connection is gone, stopping replays.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newClient creates a client of claims' principal without any
+// subscription. Its context ends with ctx or once its connection is gone.
+func newClient(ctx context.Context, hub *Hub, claims *auth.Claims, drop dropPolicy) *Client {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Client{
+		hub:     hub,
+		send:    make(chan *route, sendBuffer),
+		replies: make(chan []byte, 16),
+		claims:  claims,
+		drop:    drop,
+		sub:     newSubscription(),
+		resume:  make(chan chan *route, 1),
+		resync:  make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// wants reports whether the client should receive the event.
+func (c *Client) wants(r *route) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return allowed(c.claims, r) && c.sub.matches(r)
+}
+
+// markDropped records that n events were dropped for the client, to be
+// reported by pump.
+func (c *Client) markDropped(n int64) {
+	c.dropped.Add(n)
+	select {
+	case c.resync <- struct{}{}:
+	default:
+	}
+}
+
+// errRevoked is returned by pump once the client's session or API key was
+// revoked, or it no longer belongs to the organization it connected to.
+var errRevoked = errors.New("credentials revoked")
+
+// revalidate refreshes the client's claims with Hub.Revalidate. Failures
+// to check are logged and keep the connection open.
+func (c *Client) revalidate() error {
+	c.mu.Lock()
+	claims := c.claims
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.ctx, writeWait)
+	defer cancel()
+	fresh, err := c.hub.Revalidate(ctx, claims)
+	if err == auth.ErrRevoked {
+		return errRevoked
+	}
+	if err != nil {
+		log.Printf("Failed to revalidate event stream client: %v", err)
+		return nil
+	}
+	// Events are only ever routed for the organization selected when
+	// the connection was opened
+	if fresh.OrgID != claims.OrgID {
+		return errRevoked
+	}
+
+	c.mu.Lock()
+	c.claims = fresh
+	c.mu.Unlock()
+	return nil
 }
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+// Hub maintains the set of active clients and routes each event to the
+// clients subscribed to it. Only Run touches the clients, so routing never
+// waits on a lock, and a slow client only ever affects itself.
 type Hub struct {
+	// EventBus replays the events a reconnecting client missed.
+	EventBus *events.EventBus
+
+	// Revalidate, when set, checks the claims of open connections every
+	// revalidatePeriod. Connections whose claims return auth.ErrRevoked
+	// are closed.
+	Revalidate func(ctx context.Context, claims *auth.Claims) (*auth.Claims, error)
+
 	// Registered clients.
 	clients map[*Client]bool
 
-	// Inbound messages from the clients.
-	broadcast chan []byte
+	// Events to route to the clients.
+	broadcast chan events.CloudEvent
 
 	// Register requests from the clients.
 	register chan *Client
@@ -44,54 +229,125 @@ type Hub struct {
 	// Unregister requests from clients.
 	unregister chan *Client
 
-	mu sync.Mutex
+	// dropped counts the events Publish dropped that the clients have not
+	// been told about yet.
+	dropped atomic.Int64
 }
 
-func NewHub() *Hub {
+func NewHub(eventBus *events.EventBus) *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
+		EventBus:   eventBus,
+		broadcast:  make(chan events.CloudEvent, hubBacklog),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
 	}
 }
 
+// Publish hands an event to the hub without blocking, so the NATS
+// consumer never waits for clients. If the hub is hubBacklog events
+// behind, the event is dropped and every client is sent a ResyncMessage
+// once the hub catches up. A gap in streamseq alone does not tell, since
+// clients only receive the events they subscribed to.
+func (h *Hub) Publish(event events.CloudEvent) {
+	select {
+	case h.broadcast <- event:
+		hubMetrics.Add("events_received", 1)
+	default:
+		h.dropped.Add(1)
+		hubMetrics.Add("events_dropped", 1)
+		log.Printf("Hub is %d events behind, dropping %s event %s", hubBacklog, event.Type, event.ID)
+	}
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.mu.Lock()
 			h.clients[client] = true
-			h.mu.Unlock()
+			hubMetrics.Add("clients", 1)
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			h.remove(client)
+		case event := <-h.broadcast:
+			if n := h.dropped.Swap(0); n > 0 {
+				for client := range h.clients {
+					client.markDropped(n)
+				}
+			}
+
+			r, err := newRoute(event)
+			if err != nil {
+				log.Printf("Dropping websocket event: %v", err)
+				continue
 			}
-			h.mu.Unlock()
-		case message := <-h.broadcast:
-			h.mu.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if client.wants(r) {
+					h.deliver(client, r)
 				}
 			}
-			h.mu.Unlock()
 		}
 	}
 }
 
+// deliver queues an event for a client without blocking, applying the
+// client's drop policy when its queue is full.
+func (h *Hub) deliver(client *Client, r *route) {
+	select {
+	case client.send <- r:
+		return
+	default:
+	}
+
+	if client.drop == dropOldest {
+		// Only the hub sends, so taking one event makes room
+		select {
+		case <-client.send:
+		default:
+		}
+		client.markDropped(1)
+		client.send <- r
+		hubMetrics.Add("messages_dropped", 1)
+		return
+	}
+
+	hubMetrics.Add("clients_disconnected", 1)
+	h.remove(client)
+}
+
+// remove unregisters a client and closes its queue, which ends its pump.
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+		hubMetrics.Add("clients", -1)
+	}
+}
+
+// ServeWs upgrades an authenticated request. It must be mounted behind
+// auth.Middleware and auth.RequireOrg; the client only ever receives
+// events of the organization selected at that point. The connection is
+// closed once the session or API key is revoked or leaves that
+// organization.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	drop, err := parseDropPolicy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := newClient(context.Background(), hub, claims, drop)
+	client.conn = conn
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -102,17 +358,110 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 func (c *Client) readPump() {
 	defer func() {
+		c.cancel()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
+	c.conn.SetReadLimit(maxMessageSize)
+	// Clients that stop answering pings time out
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
+		c.handleRequest(message)
+	}
+}
+
+// handleRequest applies a subscription request and replies with the
+// resulting subscription.
+func (c *Client) handleRequest(message []byte) {
+	var req SubscriptionRequest
+	var resp SubscriptionResponse
+	if err := json.Unmarshal(message, &req); err != nil {
+		resp.Error = "invalid message"
+	} else {
+		// The replay starts under the same lock as the subscription
+		// changes, so events routed with the new subscription are sent
+		// after it
+		c.mu.Lock()
+		err := c.sub.apply(req)
+		if err == nil && req.ResumeFrom != nil {
+			err = c.startReplay(*req.ResumeFrom + 1)
+		}
+		resp = c.sub.response(req.Action)
+		c.mu.Unlock()
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	select {
+	case c.replies <- reply:
+	default:
+		// The client does not read its replies
+	}
+}
+
+// startReplay replays the events from sequence start that match the
+// subscription. c.mu must be held.
+func (c *Client) startReplay(start uint64) error {
+	if c.resuming {
+		return fmt.Errorf("a resume is already in progress")
+	}
+
+	replay := make(chan *route, 64)
+	select {
+	case c.resume <- replay:
+	default:
+		// writePump has not picked up the previous replay yet
+		return fmt.Errorf("a resume is already in progress")
+	}
+	c.resuming = true
+	go c.replay(start, replay)
+	return nil
+}
+
+// replay reads the missed events from the stream into out, filtered like
+// live events, and closes out when done.
+func (c *Client) replay(start uint64, out chan<- *route) {
+	defer func() {
+		c.mu.Lock()
+		c.resuming = false
+		c.mu.Unlock()
+		close(out)
+	}()
+
+	err := c.hub.EventBus.Replay(c.ctx, events.LifecycleStream, start, func(msg *nats.Msg, seq uint64) error {
+		event, err := events.ParseCloudEvent(msg.Data)
+		if err != nil {
+			return nil
+		}
+		event.StreamSeq = seq
+		r, err := newRoute(event)
+		if err != nil || !c.wants(r) {
+			return nil
+		}
+		select {
+		case out <- r:
+			return nil
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	})
+	if err != nil && c.ctx.Err() == nil {
+		log.Printf("Failed to replay events from %d: %v", start, err)
 	}
 }
 
@@ -120,66 +469,182 @@ func (c *Client) writePump() {
 	defer func() {
 		c.conn.Close()
 	}()
+
+	write := func(message []byte) error {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return c.conn.WriteMessage(websocket.TextMessage, message)
+	}
+	err := c.pump(sink{
+		event: func(r *route) error {
+			// One event per frame, so clients can parse each on its own
+			return write(r.message)
+		},
+		reply:  write,
+		resync: write,
+		heartbeat: func() error {
+			return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		},
+		heartbeatInterval: pingPeriod,
+	})
+	if err == errHubClosed {
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeWait))
+	} else if err == errRevoked {
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "credentials revoked"), time.Now().Add(writeWait))
+	} else if isTimeout(err) {
+		hubMetrics.Add("write_timeouts", 1)
+	}
+}
+
+// isTimeout reports whether err is a timed out read or write.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// errHubClosed is returned by pump once the hub dropped the client.
+var errHubClosed = errors.New("hub closed the client")
+
+// sink writes what pump delivers to a WebSocket or SSE connection.
+type sink struct {
+	event func(r *route) error
+	reply func(message []byte) error
+	// resync writes an encoded ResyncMessage.
+	resync func(message []byte) error
+	// heartbeat, when set, is called every heartbeatInterval to keep idle
+	// connections from being closed by proxies.
+	heartbeat         func() error
+	heartbeatInterval time.Duration
+}
+
+// pump writes the client's events to s in stream order, replays first,
+// until the hub drops the client, its claims are revoked, the client's
+// context ends or writing fails.
+func (c *Client) pump(s sink) error {
+	// lastSeq is the sequence of the last event sent. Live events routed
+	// while a replay ran may have been replayed already.
+	var lastSeq uint64
+	write := func(r *route) error {
+		if r.seq != 0 && r.seq <= lastSeq {
+			return nil
+		}
+		lastSeq = max(lastSeq, r.seq)
+		return s.event(r)
+	}
+	// resync reports the events dropped so far, if any
+	resync := func() error {
+		n := c.dropped.Swap(0)
+		if n == 0 {
+			return nil
+		}
+		message, err := json.Marshal(ResyncMessage{Action: "resync", Dropped: n})
+		if err != nil {
+			return err
+		}
+		return s.resync(message)
+	}
+	replay := func(replayed chan *route) error {
+		for r := range replayed {
+			if err := write(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var tick <-chan time.Time
+	if s.heartbeat != nil {
+		ticker := time.NewTicker(s.heartbeatInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var revalidate <-chan time.Time
+	if c.hub.Revalidate != nil {
+		ticker := time.NewTicker(revalidatePeriod)
+		defer ticker.Stop()
+		revalidate = ticker.C
+	}
+
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case replayed := <-c.resume:
+			if err := replay(replayed); err != nil {
+				return err
+			}
+		case r, ok := <-c.send:
 			if !ok {
-				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+				return errHubClosed
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			// A replay requested before the event was routed goes first
+			select {
+			case replayed := <-c.resume:
+				if err := replay(replayed); err != nil {
+					return err
+				}
+			default:
 			}
-			w.Write(message)
 
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
+			// Dropped events preceded the ones still queued
+			if err := resync(); err != nil {
+				return err
 			}
-
-			if err := w.Close(); err != nil {
-				return
+			if err := write(r); err != nil {
+				return err
+			}
+		case <-c.resync:
+			if err := resync(); err != nil {
+				return err
+			}
+		case reply := <-c.replies:
+			if err := s.reply(reply); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := s.heartbeat(); err != nil {
+				return err
+			}
+		case <-revalidate:
+			if err := c.revalidate(); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// legacyConsumers are the durable queue consumers earlier versions used
+// for fan-out. Shared by all replicas, they delivered each event to only
+// one of them.
+var legacyConsumers = []string{"api-server", "api-server-uploads", "api-server-assets"}
+
+// subscribeToEvents forwards every upload and asset event to the WebSocket
+// and SSE clients of this instance. Each API replica has its own
+// ephemeral consumer, so every replica sees every event.
 func (s *Server) subscribeToEvents() {
 	// Ensure stream exists
-	if err := s.EventBus.EnsureStream("GAMMA_ASSETS", []string{"gamma.assets.>"}); err != nil {
+	if err := s.EventBus.EnsureLifecycleStream(); err != nil {
 		log.Printf("Failed to ensure NATS stream: %v", err)
 	}
-
-	_, err := s.EventBus.Subscribe("gamma.assets.processed", "api-server", func(msg *nats.Msg) {
-		log.Printf("Received asset processed event: %s", string(msg.Data))
-
-		// Forward to WebSocket clients
-		// We might want to wrap it in a structure to indicate event type
-		type WsMessage struct {
-			Type string          `json:"type"`
-			Data json.RawMessage `json:"data"`
-		}
-
-		wsMsg := WsMessage{
-			Type: "asset_processed",
-			Data: msg.Data,
+	for _, name := range legacyConsumers {
+		if err := s.EventBus.DeleteConsumer(events.LifecycleStream, name); err != nil {
+			log.Printf("Failed to delete consumer %s: %v", name, err)
 		}
+	}
 
-		bytes, err := json.Marshal(wsMsg)
+	_, err := s.EventBus.Fanout(events.LifecycleStream, func(msg *nats.Msg) {
+		event, err := events.ParseCloudEvent(msg.Data)
 		if err != nil {
-			log.Printf("Failed to marshal websocket message: %v", err)
+			log.Printf("Dropping event on %s: %v", msg.Subject, err)
 			return
 		}
+		if meta, err := msg.Metadata(); err == nil {
+			event.StreamSeq = meta.Sequence.Stream
+		}
 
-		s.Hub.broadcast <- bytes
-		msg.Ack()
+		s.Hub.Publish(event)
 	})
-
 	if err != nil {
-		log.Printf("Failed to subscribe to asset processed events: %v", err)
+		log.Printf("Failed to subscribe to %s: %v", events.LifecycleStream, err)
 	}
 }
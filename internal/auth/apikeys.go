@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// APIKeyPrefix starts every API key so leaked keys are easy to spot.
+	APIKeyPrefix = "gamma_"
+
+	// apiKeyTouchInterval limits how often last_used_at is written for a
+	// busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// API keys belong to the organization that was selected when they were
+// created and can only access its data.
+
+// newAPIKey returns a key of the form gamma_<prefix>_<secret>. The prefix
+// is stored in clear to look the key up, the secret only as a hash.
+func newAPIKey() (key, prefix, secretHash string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, secretHash, err := newToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	return APIKeyPrefix + prefix + "_" + secret, prefix, secretHash, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// authenticateAPIKey checks key against the stored hash, expiry and
+// revocation and returns Claims limited to the key's scopes.
+func (h *Handler) authenticateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey, err := h.Queries.GetApiKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if apiKey.RevokedAt.Valid {
+		return nil, errInvalidAPIKey
+	}
+	if apiKey.ExpiresAt.Valid && time.Now().After(apiKey.ExpiresAt.Time) {
+		return nil, errInvalidAPIKey
+	}
+
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) > apiKeyTouchInterval {
+		if err := h.Queries.TouchApiKey(ctx, apiKey.ID); err != nil {
+			log.Printf("Failed to update last use of API key %s: %v", apiKey.Prefix, err)
+		}
+	}
+
+	scopes := make([]Permission, 0, len(apiKey.Scopes))
+	for _, s := range apiKey.Scopes {
+		scopes = append(scopes, Permission(s))
+	}
+
+	id := uuid.UUID(apiKey.ID.Bytes).String()
+	return &Claims{
+		APIKeyID: id,
+		Scopes:   scopes,
+		OrgID:    uuid.UUID(apiKey.OrgID.Bytes).String(),
+		EnvID:    uuid.UUID(apiKey.EnvID.Bytes).String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: id,
+		},
+	}, nil
+}
+
+type APIKeyResponse struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedBy  string       `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time   `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func newAPIKeyResponse(k db.ApiKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:         uuid.UUID(k.ID.Bytes).String(),
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     make([]Permission, 0, len(k.Scopes)),
+		ExpiresAt:  optionalTime(k.ExpiresAt),
+		LastUsedAt: optionalTime(k.LastUsedAt),
+		RevokedAt:  optionalTime(k.RevokedAt),
+		CreatedAt:  k.CreatedAt.Time,
+	}
+	for _, s := range k.Scopes {
+		resp.Scopes = append(resp.Scopes, Permission(s))
+	}
+	if k.CreatedBy.Valid {
+		resp.CreatedBy = uuid.UUID(k.CreatedBy.Bytes).String()
+	}
+	return resp
+}
+
+func optionalTime(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.Queries.ListApiKeys(r.Context(), db.ListApiKeysParams{
+		OrgID: OrgID(r.Context()),
+		EnvID: EnvID(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list API keys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResponse(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string       `json:"name"`
+	Scopes []Permission `json:"scopes"`
+	// ExpiresAt and ExpiresIn (seconds) are optional; without either the
+	// key does not expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+	ExpiresIn int64      `json:"expires_in"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	// Key is only returned once, at creation.
+	Key string `json:"key"`
+}
+
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := ClaimsFromContext(r.Context())
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		if !ValidPermission(s) {
+			http.Error(w, fmt.Sprintf("Invalid scope %q", s), http.StatusBadRequest)
+			return
+		}
+		if !claims.Can(s) {
+			http.Error(w, fmt.Sprintf("You cannot grant scope %q", s), http.StatusForbidden)
+			return
+		}
+		scopes = append(scopes, string(s))
+	}
+
+	var expiresAt pgtype.Timestamptz
+	switch {
+	case req.ExpiresAt != nil:
+		expiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	case req.ExpiresIn > 0:
+		expiresAt = pgtype.Timestamptz{Time: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second), Valid: true}
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var createdBy pgtype.UUID
+	createdBy.Scan(claims.UserID)
+
+	apiKey, err := h.Queries.CreateApiKey(r.Context(), db.CreateApiKeyParams{
+		ID:         newUUID(),
+		OrgID:      OrgID(r.Context()),
+		EnvID:      EnvID(r.Context()),
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     scopes,
+		CreatedBy:  createdBy,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newAPIKeyResponse(apiKey)
+	Audit(r.Context(), h.Queries, "api_key.create", "api_key", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{
+		APIKeyResponse: resp,
+		Key:            key,
+	})
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	apiKey, err := h.Queries.RevokeApiKey(r.Context(), db.RevokeApiKeyParams{
+		ID:    id,
+		OrgID: OrgID(r.Context()),
+		EnvID: EnvID(r.Context()),
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newAPIKeyResponse(apiKey)
+	Audit(r.Context(), h.Queries, "api_key.revoke", "api_key", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type AuditLogEntry struct {
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ListAPIKeyAudit returns the most recent actions performed with a key,
+// ?limit= defaulting to 100.
+func (h *Handler) ListAPIKeyAudit(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	entries, err := h.Queries.ListAuditLogByApiKey(r.Context(), db.ListAuditLogByApiKeyParams{
+		ApiKeyID: id,
+		OrgID:    OrgID(r.Context()),
+		Limit:    int32(limit),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]AuditLogEntry, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, AuditLogEntry{
+			Action:       e.Action,
+			ResourceType: e.ResourceType,
+			ResourceID:   e.ResourceID,
+			CreatedAt:    e.CreatedAt.Time,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"log"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+)
+
+// Audit records that the authenticated principal performed action on a
+// resource. Requests made with an API key are attributed to the key, others
+// to the user. Failures are logged and never fail the request.
+func Audit(ctx context.Context, queries *db.Queries, action, resourceType, resourceID string) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	arg := db.CreateAuditLogParams{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	}
+	if claims.APIKeyID != "" {
+		arg.ApiKeyID.Scan(claims.APIKeyID)
+	} else {
+		arg.UserID.Scan(claims.UserID)
+	}
+
+	if err := queries.CreateAuditLog(ctx, arg); err != nil {
+		log.Printf("Failed to write audit log for %s %s/%s: %v", action, resourceType, resourceID, err)
+	}
+}
@@ -1,120 +1,250 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"slices"
 	"time"
 
-	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/OZIOisgood/gamma/internal/db"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
 	CookieName = "gamma_session"
-	TokenExp   = 24 * time.Hour
+	// TokenExp is how long a session lasts without activity.
+	TokenExp = 24 * time.Hour
+	// SessionMaxExp caps a session's lifetime however active it is.
+	SessionMaxExp = 30 * 24 * time.Hour
 )
 
+type contextKey struct{}
+
+type Handler struct {
+	// Pool runs changes spanning several rows that must commit together.
+	Pool    *pgxpool.Pool
+	Queries *db.Queries
+	// OIDC is nil when single sign-on is not configured.
+	OIDC *OIDC
+}
+
+func NewHandler(pool *pgxpool.Pool) *Handler {
+	return &Handler{
+		Pool:    pool,
+		Queries: db.New(pool),
+	}
+}
+
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
+// Claims are the payload of the session token. RegisteredClaims.ID holds
+// the ID of the server-side session record.
 type Claims struct {
+	UserID   string `json:"uid"`
 	Username string `json:"username"`
+	// Role is the user's role in OrgID, "" when no organization is
+	// selected. It is looked up on every request, never read from the token.
+	Role string `json:"-"`
 	jwt.RegisteredClaims
+
+	// APIKeyID and Scopes are set instead of the user fields when the
+	// request is authenticated with an API key.
+	APIKeyID string       `json:"-"`
+	Scopes   []Permission `json:"-"`
+	// OrgID is the organization the request is scoped to: the one selected
+	// in the session, or the one the API key belongs to.
+	OrgID string `json:"-"`
+	// EnvID is the environment an API key belongs to. Sessions pick the
+	// environment per request, see SelectEnvironment.
+	EnvID string `json:"-"`
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
+// Can reports whether the principal may perform perm: API keys are limited
+// to their scopes, users to the permissions of their role in the selected
+// organization.
+func (c *Claims) Can(perm Permission) bool {
+	if c.APIKeyID != "" {
+		return slices.Contains(c.Scopes, perm)
+	}
+	return HasPermission(db.UserRole(c.Role), perm)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	expectedUser := tools.GetEnv("DASHBOARD_USER")
-	expectedPass := tools.GetEnv("DASHBOARD_PASSWORD")
-
-	if creds.Username != expectedUser || creds.Password != expectedPass {
+	user, err := h.Queries.GetUserByUsername(r.Context(), creds.Username)
+	if err != nil {
+		// Hash anyway so unknown usernames take as long as wrong passwords
+		CheckPassword(dummyHash, creds.Password)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	expirationTime := time.Now().Add(TokenExp)
-	claims := &Claims{
-		Username: creds.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	if user.Disabled || !user.PasswordHash.Valid || !CheckPassword(user.PasswordHash.String, creds.Password) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
+	if err := IssueSession(w, r, h.Queries, user); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     CookieName,
-		Value:    tokenString,
-		Expires:  expirationTime,
-		HttpOnly: true,
-		Path:     "/",
-		SameSite: http.SameSiteStrictMode,
-		// Secure: true, // Uncomment in production with HTTPS
-	})
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Logged in"))
 }
 
-func Logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     CookieName,
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-		Path:     "/",
+type ProvidersResponse struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+// Providers tells the login page which sign-in methods are available.
+func (h *Handler) Providers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProvidersResponse{
+		Password: true,
+		OIDC:     h.OIDC != nil,
 	})
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if claims, err := parseSessionCookie(r); err == nil {
+		var sessionID, userID pgtype.UUID
+		sessionID.Scan(claims.ID)
+		userID.Scan(claims.UserID)
+		h.Queries.RevokeSession(r.Context(), db.RevokeSessionParams{
+			ID:     sessionID,
+			UserID: userID,
+		})
+	}
+
+	clearSessionCookies(w, r)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Logged out"))
 }
 
-func Middleware(next http.Handler) http.Handler {
+// Middleware authenticates the request with either an API key sent as
+// "Authorization: Bearer <key>" or the session cookie, and stores the
+// resulting Claims in the request context. Cookie-authenticated requests
+// that change state must also send the CSRF token in X-CSRF-Token.
+func (h *Handler) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c, err := r.Cookie(CookieName)
-		if err != nil {
-			if err == http.ErrNoCookie {
+		if key, ok := bearerToken(r); ok {
+			claims, err := h.authenticateAPIKey(r.Context(), key)
+			if err != nil {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+
+			ctx := context.WithValue(r.Context(), contextKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		tknStr := c.Value
-		claims := &Claims{}
-
-		jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
-		tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
+		claims, err := h.authenticateSession(w, r)
 		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if !tkn.Valid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !safeMethod(r.Method) && !validCSRF(r, claims.ID) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
 			return
 		}
+		// Lets clients that cannot read the cookie pick up the token
+		w.Header().Set(CSRFHeader, csrfToken(claims.ID))
 
+		ctx := context.WithValue(r.Context(), contextKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClaimsFromContext returns the session claims stored by Middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// UserID returns the ID of the authenticated user, or "" outside
+// Middleware and for API keys.
+func UserID(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.UserID
+	}
+	return ""
+}
+
+// OrgID returns the organization the request is scoped to. It is not
+// valid outside Middleware or when no organization is selected.
+func OrgID(ctx context.Context) pgtype.UUID {
+	var id pgtype.UUID
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.OrgID != "" {
+		id.Scan(claims.OrgID)
+	}
+	return id
+}
+
+// RequireOrg rejects requests without a selected organization. It must be
+// used after Middleware.
+func RequireOrg(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !OrgID(r.Context()).Valid {
+			http.Error(w, "No organization selected", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// EnsureBootstrapAdmin creates an administrator from DASHBOARD_USER and
+// DASHBOARD_PASSWORD when there are no users yet, so existing deployments
+// keep their login after upgrading. The admin joins the default
+// organization.
+func EnsureBootstrapAdmin(ctx context.Context, queries *db.Queries, username, password string) error {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	count, err := queries.CountUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		ID:           newUUID(),
+		Username:     username,
+		PasswordHash: hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	org, err := queries.GetOrganizationBySlug(ctx, DefaultOrgSlug)
+	if err != nil {
+		return err
+	}
+	return queries.AddOrganizationMember(ctx, db.AddOrganizationMemberParams{
+		OrgID:  org.ID,
+		UserID: user.ID,
+		Role:   db.UserRoleAdmin,
+	})
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// EnvironmentHeader selects the environment of a request. Routes mounted
+// below /env/{env} take it from the path instead.
+const EnvironmentHeader = "X-Gamma-Environment"
+
+// DefaultEnvironment is used when a session request names no environment.
+const DefaultEnvironment = "prod"
+
+// DefaultEnvironments are created with every organization.
+var DefaultEnvironments = []string{"dev", "qa", "prod"}
+
+type envContextKey struct{}
+
+// EnvironmentSettings are the per-environment options stored in
+// environments.settings.
+type EnvironmentSettings struct {
+	// Deduplicate is the default for uploads that do not set it.
+	Deduplicate *bool `json:"deduplicate,omitempty"`
+	// Encrypt is the default for uploads that do not set it.
+	Encrypt *bool `json:"encrypt,omitempty"`
+	// DRMScheme is the default Common Encryption scheme, "cenc" or "cbcs".
+	DRMScheme string `json:"drm_scheme,omitempty"`
+}
+
+// ParseEnvironmentSettings decodes stored settings. Invalid settings are
+// treated as empty.
+func ParseEnvironmentSettings(data []byte) EnvironmentSettings {
+	var settings EnvironmentSettings
+	json.Unmarshal(data, &settings)
+	return settings
+}
+
+// SelectEnvironment returns a middleware resolving the environment named
+// by the {env} path parameter or the EnvironmentHeader, defaulting to
+// DefaultEnvironment, within the request's organization. API keys are
+// bound to the environment they were created in and may not name another.
+// It must be used after RequireOrg.
+func SelectEnvironment(queries *db.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := chi.URLParam(r, "env")
+			if name == "" {
+				name = r.Header.Get(EnvironmentHeader)
+			}
+
+			claims, _ := ClaimsFromContext(r.Context())
+
+			var env db.Environment
+			var err error
+			if claims.EnvID != "" {
+				var id pgtype.UUID
+				id.Scan(claims.EnvID)
+				env, err = queries.GetEnvironment(r.Context(), id)
+				if err == nil && name != "" && name != env.Name {
+					http.Error(w, fmt.Sprintf("API key belongs to environment %s", env.Name), http.StatusForbidden)
+					return
+				}
+			} else {
+				if name == "" {
+					name = DefaultEnvironment
+				}
+				env, err = queries.GetEnvironmentByName(r.Context(), db.GetEnvironmentByNameParams{
+					OrgID: OrgID(r.Context()),
+					Name:  name,
+				})
+			}
+			if err == pgx.ErrNoRows {
+				http.Error(w, "Environment not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get environment: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set(EnvironmentHeader, env.Name)
+			ctx := context.WithValue(r.Context(), envContextKey{}, env)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Environment returns the environment selected by SelectEnvironment.
+func Environment(ctx context.Context) (db.Environment, bool) {
+	env, ok := ctx.Value(envContextKey{}).(db.Environment)
+	return env, ok
+}
+
+// EnvID returns the ID of the selected environment. It is not valid
+// outside SelectEnvironment.
+func EnvID(ctx context.Context) pgtype.UUID {
+	env, _ := Environment(ctx)
+	return env.ID
+}
+
+type EnvironmentResponse struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Settings  json.RawMessage `json:"settings"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func newEnvironmentResponse(env db.Environment) EnvironmentResponse {
+	return EnvironmentResponse{
+		ID:        uuid.UUID(env.ID.Bytes).String(),
+		Name:      env.Name,
+		Settings:  json.RawMessage(env.Settings),
+		CreatedAt: env.CreatedAt.Time,
+	}
+}
+
+// ListEnvironments returns the environments of the current organization.
+func (h *Handler) ListEnvironments(w http.ResponseWriter, r *http.Request) {
+	envs, err := h.Queries.ListEnvironments(r.Context(), OrgID(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list environments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]EnvironmentResponse, 0, len(envs))
+	for _, env := range envs {
+		resp = append(resp, newEnvironmentResponse(env))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetEnvironment returns the selected environment and its settings.
+func (h *Handler) GetEnvironment(w http.ResponseWriter, r *http.Request) {
+	env, _ := Environment(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newEnvironmentResponse(env))
+}
+
+type CreateEnvironmentRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *Handler) CreateEnvironment(w http.ResponseWriter, r *http.Request) {
+	var req CreateEnvironmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !slugPattern.MatchString(req.Name) {
+		http.Error(w, "Name must be 2-63 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+
+	env, err := h.Queries.CreateEnvironment(r.Context(), db.CreateEnvironmentParams{
+		ID:    newUUID(),
+		OrgID: OrgID(r.Context()),
+		Name:  req.Name,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "An environment with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create environment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newEnvironmentResponse(env)
+	Audit(r.Context(), h.Queries, "environment.create", "environment", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UpdateEnvironmentSettings replaces the selected environment's settings.
+// Unknown settings are rejected.
+func (h *Handler) UpdateEnvironmentSettings(w http.ResponseWriter, r *http.Request) {
+	var settings EnvironmentSettings
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid settings: %v", err), http.StatusBadRequest)
+		return
+	}
+	if settings.DRMScheme != "" && !keys.ValidScheme(settings.DRMScheme) {
+		http.Error(w, "drm_scheme must be cenc or cbcs", http.StatusBadRequest)
+		return
+	}
+	data, _ := json.Marshal(settings)
+
+	current, _ := Environment(r.Context())
+	env, err := h.Queries.UpdateEnvironmentSettings(r.Context(), db.UpdateEnvironmentSettingsParams{
+		ID:       current.ID,
+		OrgID:    current.OrgID,
+		Settings: data,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newEnvironmentResponse(env)
+	Audit(r.Context(), h.Queries, "environment.update_settings", "environment", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,499 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// OIDCCookieName holds the state, nonce and PKCE verifier between
+	// /auth/oidc/login and /auth/oidc/callback.
+	OIDCCookieName = "gamma_oidc"
+	OIDCFlowExp    = 10 * time.Minute
+)
+
+// rolesByPrivilege orders roles from most to least privileged, so a user in
+// several mapped groups gets the highest role.
+var rolesByPrivilege = []db.UserRole{
+	db.UserRoleAdmin,
+	db.UserRoleEditor,
+	db.UserRoleUploader,
+	db.UserRoleViewer,
+}
+
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string
+	// RoleMapping maps IdP groups to roles. When it is empty roles are
+	// managed in Gamma and only set once, when the user is created.
+	RoleMapping map[string]db.UserRole
+	// DefaultRole is given to users in none of the mapped groups. When it
+	// is empty those users are rejected.
+	DefaultRole db.UserRole
+	// PostLoginURL is where the browser is sent after the callback, with
+	// ?sso=ok or ?sso=error&error=<code> appended.
+	PostLoginURL string
+	// DefaultOrg is the slug of the organization new users join.
+	DefaultOrg string
+}
+
+// OIDCConfigFromEnv reads the OIDC_* variables. It returns false when
+// OIDC_ISSUER_URL is not set, which disables single sign-on.
+func OIDCConfigFromEnv() (OIDCConfig, bool, error) {
+	cfg := OIDCConfig{
+		IssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		DefaultRole:  db.UserRole(os.Getenv("OIDC_DEFAULT_ROLE")),
+		PostLoginURL: os.Getenv("OIDC_POST_LOGIN_URL"),
+		DefaultOrg:   os.Getenv("OIDC_DEFAULT_ORG"),
+		RoleMapping:  map[string]db.UserRole{},
+	}
+	if cfg.IssuerURL == "" {
+		return cfg, false, nil
+	}
+	cfg.ClientID = tools.GetEnv("OIDC_CLIENT_ID")
+
+	if cfg.RedirectURL == "" {
+		cfg.RedirectURL = "http://localhost:8080/auth/oidc/callback"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.PostLoginURL == "" {
+		cfg.PostLoginURL = "http://localhost:4200/login"
+	}
+	if cfg.DefaultOrg == "" {
+		cfg.DefaultOrg = DefaultOrgSlug
+	}
+
+	switch cfg.DefaultRole {
+	case "":
+		cfg.DefaultRole = db.UserRoleViewer
+	case "none":
+		cfg.DefaultRole = ""
+	default:
+		if !ValidRole(cfg.DefaultRole) {
+			return cfg, false, fmt.Errorf("invalid OIDC_DEFAULT_ROLE %q", cfg.DefaultRole)
+		}
+	}
+
+	scopes := os.Getenv("OIDC_SCOPES")
+	if scopes == "" {
+		scopes = "openid profile email"
+	}
+	cfg.Scopes = strings.Fields(scopes)
+
+	// OIDC_ROLE_MAPPING is a comma-separated list of group=role pairs
+	for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAPPING"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || !ValidRole(db.UserRole(role)) {
+			return cfg, false, fmt.Errorf("invalid OIDC_ROLE_MAPPING entry %q", pair)
+		}
+		cfg.RoleMapping[group] = db.UserRole(role)
+	}
+
+	return cfg, true, nil
+}
+
+// OIDC implements the authorization code flow with PKCE against an OpenID
+// Connect provider and signs users in with the regular session cookie.
+type OIDC struct {
+	Queries *db.Queries
+	Config  OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDC(queries *db.Queries, cfg OIDCConfig) *OIDC {
+	return &OIDC{
+		Queries: queries,
+		Config:  cfg,
+	}
+}
+
+// discover fetches the provider configuration on first use, so the API can
+// start before the IdP is reachable.
+func (o *OIDC) discover(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, o.Config.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	o.provider = provider
+	return provider, nil
+}
+
+func (o *OIDC) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.Config.ClientID,
+		ClientSecret: o.Config.ClientSecret,
+		RedirectURL:  o.Config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       o.Config.Scopes,
+	}
+}
+
+type oidcFlowClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// Login redirects the browser to the provider's authorization endpoint.
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	provider, err := o.discover(r.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		http.Error(w, "Single sign-on is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	flow := oidcFlowClaims{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OIDCFlowExp)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, flow)
+	jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Lax, not Strict: the callback is a cross-site redirect from the IdP
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCCookieName,
+		Value:    tokenString,
+		Expires:  time.Now().Add(OIDCFlowExp),
+		HttpOnly: true,
+		Path:     "/auth/oidc",
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secureCookies(r),
+	})
+
+	authURL := o.oauth2Config(provider).AuthCodeURL(flow.State,
+		oidc.Nonce(flow.Nonce),
+		oauth2.S256ChallengeOption(flow.Verifier),
+	)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+type oidcUserClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Callback exchanges the authorization code, verifies the ID token and
+// issues the gamma_session cookie for the matching user, creating it on
+// first login.
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flow, err := readOIDCFlow(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HttpOnly: true,
+		Path:     "/auth/oidc",
+	})
+	if err != nil {
+		http.Error(w, "Login session expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("state") != flow.State {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		log.Printf("OIDC provider returned %s: %s", e, query.Get("error_description"))
+		o.redirectError(w, r, e)
+		return
+	}
+
+	provider, err := o.discover(ctx)
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		http.Error(w, "Single sign-on is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	token, err := o.oauth2Config(provider).Exchange(ctx, query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		o.redirectError(w, r, "exchange_failed")
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		o.redirectError(w, r, "missing_id_token")
+		return
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: o.Config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("OIDC ID token verification failed: %v", err)
+		o.redirectError(w, r, "invalid_id_token")
+		return
+	}
+	if idToken.Nonce != flow.Nonce {
+		o.redirectError(w, r, "invalid_id_token")
+		return
+	}
+
+	var claims oidcUserClaims
+	var rawClaims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		o.redirectError(w, r, "invalid_id_token")
+		return
+	}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		o.redirectError(w, r, "invalid_id_token")
+		return
+	}
+
+	role, ok := o.mapRole(groupsFromClaim(rawClaims[o.Config.GroupsClaim]))
+	if !ok {
+		o.redirectError(w, r, "access_denied")
+		return
+	}
+
+	user, err := o.findOrCreateUser(ctx, idToken.Issuer, idToken.Subject, claims, role)
+	if errors.Is(err, errOIDCAccountConflict) {
+		o.redirectError(w, r, "account_conflict")
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC user lookup failed: %v", err)
+		o.redirectError(w, r, "server_error")
+		return
+	}
+
+	if user.Disabled {
+		o.redirectError(w, r, "account_disabled")
+		return
+	}
+
+	// With a role mapping the IdP owns roles in the default organization,
+	// so group changes apply on the next login
+	if len(o.Config.RoleMapping) > 0 {
+		if err := o.syncRole(ctx, user, role); err != nil {
+			log.Printf("Failed to sync role from OIDC groups: %v", err)
+			o.redirectError(w, r, "server_error")
+			return
+		}
+	}
+
+	if err := IssueSession(w, r, o.Queries, user); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, o.postLoginURL(url.Values{"sso": {"ok"}}), http.StatusFound)
+}
+
+var errOIDCAccountConflict = errors.New("username or email belongs to another account")
+
+// findOrCreateUser returns the user linked to the issuer and subject. An
+// unlinked user with the same verified email is linked on first login;
+// otherwise a new passwordless user is created.
+func (o *OIDC) findOrCreateUser(ctx context.Context, issuer, subject string, claims oidcUserClaims, role db.UserRole) (db.User, error) {
+	pgIssuer := pgtype.Text{String: issuer, Valid: true}
+	pgSubject := pgtype.Text{String: subject, Valid: true}
+
+	user, err := o.Queries.GetUserByOidcSubject(ctx, db.GetUserByOidcSubjectParams{
+		OidcIssuer:  pgIssuer,
+		OidcSubject: pgSubject,
+	})
+	if err != pgx.ErrNoRows {
+		return user, err
+	}
+
+	email := pgtype.Text{String: claims.Email, Valid: claims.Email != ""}
+	if email.Valid && claims.EmailVerified {
+		user, err := o.Queries.GetUserByEmail(ctx, email)
+		if err == nil {
+			if user.OidcSubject.Valid {
+				return db.User{}, errOIDCAccountConflict
+			}
+			return o.Queries.LinkUserOidc(ctx, db.LinkUserOidcParams{
+				ID:          user.ID,
+				OidcIssuer:  pgIssuer,
+				OidcSubject: pgSubject,
+			})
+		}
+		if err != pgx.ErrNoRows {
+			return db.User{}, err
+		}
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = subject
+	}
+
+	user, err = o.Queries.CreateOidcUser(ctx, db.CreateOidcUserParams{
+		ID:          newUUID(),
+		Username:    username,
+		Email:       email,
+		Name:        claims.Name,
+		OidcIssuer:  pgIssuer,
+		OidcSubject: pgSubject,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return db.User{}, errOIDCAccountConflict
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+
+	org, err := o.Queries.GetOrganizationBySlug(ctx, o.Config.DefaultOrg)
+	if err != nil {
+		return db.User{}, fmt.Errorf("default organization %q: %w", o.Config.DefaultOrg, err)
+	}
+	err = o.Queries.AddOrganizationMember(ctx, db.AddOrganizationMemberParams{
+		OrgID:  org.ID,
+		UserID: user.ID,
+		Role:   role,
+	})
+	return user, err
+}
+
+// syncRole sets the user's role in the default organization, if they are
+// a member of it.
+func (o *OIDC) syncRole(ctx context.Context, user db.User, role db.UserRole) error {
+	org, err := o.Queries.GetOrganizationBySlug(ctx, o.Config.DefaultOrg)
+	if err != nil {
+		return fmt.Errorf("default organization %q: %w", o.Config.DefaultOrg, err)
+	}
+	_, err = o.Queries.SetOrganizationMemberRole(ctx, db.SetOrganizationMemberRoleParams{
+		OrgID:  org.ID,
+		UserID: user.ID,
+		Role:   role,
+	})
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// mapRole returns the most privileged role mapped from groups, or the
+// default role. It returns false when the user may not sign in.
+func (o *OIDC) mapRole(groups []string) (db.UserRole, bool) {
+	for _, role := range rolesByPrivilege {
+		for _, g := range groups {
+			if o.Config.RoleMapping[g] == role {
+				return role, true
+			}
+		}
+	}
+	return o.Config.DefaultRole, o.Config.DefaultRole != ""
+}
+
+// groupsFromClaim accepts both a list of groups and a single string, which
+// some providers send for users in one group.
+func groupsFromClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		groups := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+func (o *OIDC) redirectError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, o.postLoginURL(url.Values{"sso": {"error"}, "error": {code}}), http.StatusFound)
+}
+
+func (o *OIDC) postLoginURL(params url.Values) string {
+	sep := "?"
+	if strings.Contains(o.Config.PostLoginURL, "?") {
+		sep = "&"
+	}
+	return o.Config.PostLoginURL + sep + params.Encode()
+}
+
+func readOIDCFlow(r *http.Request) (*oidcFlowClaims, error) {
+	c, err := r.Cookie(OIDCCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &oidcFlowClaims{}
+	jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
+	tkn, err := jwt.ParseWithClaims(c.Value, flow, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !tkn.Valid {
+		return nil, errors.New("invalid OIDC flow cookie")
+	}
+	return flow, nil
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,375 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultOrgSlug is the organization created by the migration that
+// introduced organizations. Existing data and new SSO users land in it.
+const DefaultOrgSlug = "default"
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+type OrgResponse struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newOrgResponses(orgs []db.Organization, currentID string) []OrgResponse {
+	resp := make([]OrgResponse, 0, len(orgs))
+	for _, o := range orgs {
+		id := uuid.UUID(o.ID.Bytes).String()
+		resp = append(resp, OrgResponse{
+			ID:        id,
+			Slug:      o.Slug,
+			Name:      o.Name,
+			Current:   id == currentID,
+			CreatedAt: o.CreatedAt.Time,
+		})
+	}
+	return resp
+}
+
+// ListOrgs returns the organizations the user belongs to, or the API key's
+// organization.
+func (h *Handler) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	var orgs []db.Organization
+	var err error
+	switch {
+	case claims.APIKeyID != "":
+		var org db.Organization
+		org, err = h.Queries.GetOrganization(r.Context(), OrgID(r.Context()))
+		orgs = []db.Organization{org}
+	default:
+		var userID pgtype.UUID
+		userID.Scan(claims.UserID)
+		orgs, err = h.Queries.ListUserOrganizations(r.Context(), userID)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list organizations: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newOrgResponses(orgs, claims.OrgID))
+}
+
+type CreateOrgRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// CreateOrg creates an organization with the caller as its first member
+// and admin.
+func (h *Handler) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	var req CreateOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !slugPattern.MatchString(req.Slug) {
+		http.Error(w, "Slug must be 2-63 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.Slug
+	}
+
+	// The organization, its environments and the creator's membership
+	// commit together so a failure leaves no half-created organization.
+	var org db.Organization
+	err := pgx.BeginFunc(r.Context(), h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		var err error
+		org, err = q.CreateOrganization(r.Context(), db.CreateOrganizationParams{
+			ID:   newUUID(),
+			Slug: req.Slug,
+			Name: req.Name,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range DefaultEnvironments {
+			_, err := q.CreateEnvironment(r.Context(), db.CreateEnvironmentParams{
+				ID:    newUUID(),
+				OrgID: org.ID,
+				Name:  name,
+			})
+			if err != nil {
+				return fmt.Errorf("create environment: %w", err)
+			}
+		}
+
+		var userID pgtype.UUID
+		if userID.Scan(UserID(r.Context())) != nil {
+			return nil
+		}
+		err = q.AddOrganizationMember(r.Context(), db.AddOrganizationMemberParams{
+			OrgID:  org.ID,
+			UserID: userID,
+			Role:   db.UserRoleAdmin,
+		})
+		if err != nil {
+			return fmt.Errorf("add member: %w", err)
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "organizations_slug_key" {
+		http.Error(w, "An organization with this slug already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create organization: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newOrgResponses([]db.Organization{org}, "")[0]
+	Audit(r.Context(), h.Queries, "org.create", "organization", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok || !h.canAccessOrg(w, r, id) {
+		return
+	}
+
+	members, err := h.Queries.ListOrganizationMembers(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list members: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]UserResponse, 0, len(members))
+	for _, m := range members {
+		resp = append(resp, newUserResponse(m.User, m.Role))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type AddOrgMemberRequest struct {
+	// Role defaults to viewer.
+	Role db.UserRole `json:"role"`
+}
+
+// AddOrgMember adds a user to an organization. The request body is
+// optional.
+func (h *Handler) AddOrgMember(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, ok := parseMemberIDs(w, r)
+	if !ok || !h.canAccessOrg(w, r, orgID) {
+		return
+	}
+
+	var req AddOrgMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = db.UserRoleViewer
+	}
+	if !ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.Queries.GetOrganization(r.Context(), orgID); err != nil {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+	if _, err := h.Queries.GetUser(r.Context(), userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.Queries.AddOrganizationMember(r.Context(), db.AddOrganizationMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+		Role:   req.Role,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	Audit(r.Context(), h.Queries, "org.add_member", "user", chi.URLParam(r, "userId"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveOrgMember removes a user from an organization and deselects it in
+// their sessions.
+func (h *Handler) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	orgID, userID, ok := parseMemberIDs(w, r)
+	if !ok || !h.canAccessOrg(w, r, orgID) {
+		return
+	}
+
+	err := h.Queries.RemoveOrganizationMember(r.Context(), db.RemoveOrganizationMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to remove member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Queries.ClearSessionOrg(r.Context(), db.ClearSessionOrgParams{
+		UserID: userID,
+		OrgID:  orgID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update sessions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	Audit(r.Context(), h.Queries, "org.remove_member", "user", chi.URLParam(r, "userId"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type SwitchOrgRequest struct {
+	// OrgID or Slug selects the organization.
+	OrgID string `json:"org_id"`
+	Slug  string `json:"slug"`
+}
+
+// SwitchOrg selects the organization the current session works in.
+func (h *Handler) SwitchOrg(w http.ResponseWriter, r *http.Request) {
+	var req SwitchOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := ClaimsFromContext(r.Context())
+	if claims.APIKeyID != "" {
+		http.Error(w, "API keys are bound to their organization", http.StatusBadRequest)
+		return
+	}
+
+	var org db.Organization
+	var err error
+	if req.Slug != "" {
+		org, err = h.Queries.GetOrganizationBySlug(r.Context(), req.Slug)
+	} else {
+		var id pgtype.UUID
+		if scanErr := id.Scan(req.OrgID); scanErr != nil {
+			http.Error(w, "Invalid UUID", http.StatusBadRequest)
+			return
+		}
+		org, err = h.Queries.GetOrganization(r.Context(), id)
+	}
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get organization: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var userID, sessionID pgtype.UUID
+	userID.Scan(claims.UserID)
+	sessionID.Scan(claims.ID)
+
+	member, err := h.Queries.IsOrganizationMember(r.Context(), db.IsOrganizationMemberParams{
+		OrgID:  org.ID,
+		UserID: userID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !member {
+		http.Error(w, "You are not a member of this organization", http.StatusForbidden)
+		return
+	}
+
+	err = h.Queries.SetSessionOrg(r.Context(), db.SetSessionOrgParams{
+		ID:    sessionID,
+		OrgID: org.ID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to switch organization: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newOrgResponses([]db.Organization{org}, uuid.UUID(org.ID.Bytes).String())[0]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// canAccessOrg reports whether the caller may manage orgID: API keys only
+// their own organization, users only organizations where their role has
+// orgs:manage. Organizations the user does not belong to are answered
+// with 404 so their existence is not revealed.
+func (h *Handler) canAccessOrg(w http.ResponseWriter, r *http.Request, orgID pgtype.UUID) bool {
+	claims, _ := ClaimsFromContext(r.Context())
+
+	if claims.APIKeyID != "" {
+		if uuid.UUID(orgID.Bytes).String() != claims.OrgID {
+			http.Error(w, "Organization not found", http.StatusNotFound)
+			return false
+		}
+		return true
+	}
+
+	var userID pgtype.UUID
+	userID.Scan(claims.UserID)
+	member, err := h.Queries.GetOrganizationMember(r.Context(), db.GetOrganizationMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if !HasPermission(member.Role, PermOrgsManage) {
+		writeForbidden(w, string(member.Role), PermOrgsManage)
+		return false
+	}
+	return true
+}
+
+func parseMemberIDs(w http.ResponseWriter, r *http.Request) (pgtype.UUID, pgtype.UUID, bool) {
+	orgID, ok := parseID(w, r)
+	if !ok {
+		return orgID, pgtype.UUID{}, false
+	}
+
+	var userID pgtype.UUID
+	if err := userID.Scan(chi.URLParam(r, "userId")); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return orgID, userID, false
+	}
+	return orgID, userID, true
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const MinPasswordLength = 8
+
+// dummyHash is compared against when a user does not exist so that login
+// timing does not reveal which usernames are taken.
+var dummyHash = func() string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gamma-dummy-password"), bcrypt.DefaultCost)
+	return string(hash)
+}()
+
+func HashPassword(password string) (pgtype.Text, error) {
+	if len(password) < MinPasswordLength {
+		return pgtype.Text{}, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return pgtype.Text{}, err
+	}
+	return pgtype.Text{String: string(hash), Valid: true}, nil
+}
+
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// newToken returns a random single-use token and the hash stored in its
+// place.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newUUID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
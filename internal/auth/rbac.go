@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+)
+
+type Permission string
+
+const (
+	// PermAssetsRead allows listing, searching and playing assets.
+	PermAssetsRead Permission = "assets:read"
+	// PermAssetsWrite allows editing and deleting assets.
+	PermAssetsWrite Permission = "assets:write"
+	// PermAssetsPromote allows copying assets to another environment.
+	PermAssetsPromote Permission = "assets:promote"
+	// PermUploadsRead allows listing uploads and checking their status.
+	PermUploadsRead Permission = "uploads:read"
+	// PermUploadsCreate allows uploading new videos.
+	PermUploadsCreate Permission = "uploads:create"
+	// PermUsersManage allows inviting, disabling and changing roles of users.
+	PermUsersManage Permission = "users:manage"
+	// PermAPIKeysManage allows creating and revoking API keys.
+	PermAPIKeysManage Permission = "api_keys:manage"
+	// PermOrgsManage allows creating organizations and managing members.
+	PermOrgsManage Permission = "orgs:manage"
+	// PermWebhooksManage allows registering webhook endpoints and
+	// inspecting their deliveries.
+	PermWebhooksManage Permission = "webhooks:manage"
+)
+
+var rolePermissions = map[db.UserRole][]Permission{
+	db.UserRoleAdmin: {
+		PermAssetsRead, PermAssetsWrite, PermAssetsPromote,
+		PermUploadsRead, PermUploadsCreate,
+		PermUsersManage, PermAPIKeysManage, PermOrgsManage, PermWebhooksManage,
+	},
+	db.UserRoleEditor: {
+		PermAssetsRead, PermAssetsWrite, PermAssetsPromote,
+		PermUploadsRead, PermUploadsCreate,
+	},
+	db.UserRoleUploader: {
+		PermAssetsRead,
+		PermUploadsRead, PermUploadsCreate,
+	},
+	db.UserRoleViewer: {
+		PermAssetsRead,
+		PermUploadsRead,
+	},
+}
+
+// ValidPermission reports whether perm is one of the known permissions.
+func ValidPermission(perm Permission) bool {
+	return slices.Contains(rolePermissions[db.UserRoleAdmin], perm)
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role db.UserRole) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role db.UserRole, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+type ForbiddenResponse struct {
+	Error      string     `json:"error"`
+	Message    string     `json:"message"`
+	Permission Permission `json:"permission"`
+	Role       string     `json:"role,omitempty"`
+}
+
+// Require returns a middleware rejecting requests whose role lacks perm
+// with 403 and a ForbiddenResponse body. It must be used after Middleware.
+func Require(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if ok && claims.Can(perm) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var role string
+			if ok {
+				role = claims.Role
+			}
+			writeForbidden(w, role, perm)
+		})
+	}
+}
+
+func writeForbidden(w http.ResponseWriter, role string, perm Permission) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(ForbiddenResponse{
+		Error:      "forbidden",
+		Message:    "You do not have permission to perform this action",
+		Permission: perm,
+		Role:       role,
+	})
+}
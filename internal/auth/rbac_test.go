@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+)
+
+// allPermissions lists every permission in the order of the README table.
+var allPermissions = []Permission{
+	PermAssetsRead, PermAssetsWrite, PermAssetsPromote,
+	PermUploadsRead, PermUploadsCreate,
+	PermUsersManage, PermAPIKeysManage, PermOrgsManage, PermWebhooksManage,
+}
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		role db.UserRole
+		want []Permission
+	}{
+		{db.UserRoleAdmin, allPermissions},
+		{db.UserRoleEditor, []Permission{PermAssetsRead, PermAssetsWrite, PermAssetsPromote, PermUploadsRead, PermUploadsCreate}},
+		{db.UserRoleUploader, []Permission{PermAssetsRead, PermUploadsRead, PermUploadsCreate}},
+		{db.UserRoleViewer, []Permission{PermAssetsRead, PermUploadsRead}},
+		{"", nil},
+		{"owner", nil},
+	}
+	for _, tt := range tests {
+		for _, perm := range allPermissions {
+			want := false
+			for _, p := range tt.want {
+				want = want || p == perm
+			}
+			if got := HasPermission(tt.role, perm); got != want {
+				t.Errorf("HasPermission(%q, %s) = %v, want %v", tt.role, perm, got, want)
+			}
+		}
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range []db.UserRole{db.UserRoleAdmin, db.UserRoleEditor, db.UserRoleViewer, db.UserRoleUploader} {
+		if !ValidRole(role) {
+			t.Errorf("ValidRole(%q) = false, want true", role)
+		}
+	}
+	for _, role := range []db.UserRole{"", "owner", "Admin"} {
+		if ValidRole(role) {
+			t.Errorf("ValidRole(%q) = true, want false", role)
+		}
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	for _, perm := range allPermissions {
+		if !ValidPermission(perm) {
+			t.Errorf("ValidPermission(%s) = false, want true", perm)
+		}
+	}
+	for _, perm := range []Permission{"", "assets:*", "assets:delete"} {
+		if ValidPermission(perm) {
+			t.Errorf("ValidPermission(%q) = true, want false", perm)
+		}
+	}
+}
+
+func TestClaimsCan(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims Claims
+		perm   Permission
+		want   bool
+	}{
+		{"role grants", Claims{Role: "editor"}, PermAssetsWrite, true},
+		{"role lacks", Claims{Role: "editor"}, PermUsersManage, false},
+		{"no role", Claims{}, PermAssetsRead, false},
+		{"scope grants", Claims{APIKeyID: "key", Scopes: []Permission{PermUploadsCreate}}, PermUploadsCreate, true},
+		{"scope lacks", Claims{APIKeyID: "key", Scopes: []Permission{PermUploadsCreate}}, PermAssetsRead, false},
+		// API keys are limited to their scopes, whatever role is set
+		{"API key ignores role", Claims{APIKeyID: "key", Role: "admin"}, PermAssetsRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.Can(tt.perm); got != tt.want {
+				t.Errorf("Can(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     *Claims
+		perm       Permission
+		wantStatus int
+	}{
+		{"allowed", &Claims{Role: "admin"}, PermUsersManage, http.StatusOK},
+		{"forbidden", &Claims{Role: "viewer"}, PermAssetsWrite, http.StatusForbidden},
+		{"API key scope", &Claims{APIKeyID: "key", Scopes: []Permission{PermAssetsWrite}}, PermAssetsWrite, http.StatusOK},
+		{"no claims", nil, PermAssetsRead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), contextKey{}, tt.claims))
+			}
+			w := httptest.NewRecorder()
+			Require(tt.perm)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusForbidden {
+				return
+			}
+
+			var resp ForbiddenResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("invalid body: %v", err)
+			}
+			if resp.Error != "forbidden" || resp.Permission != tt.perm {
+				t.Errorf("got %+v, want error forbidden and permission %s", resp, tt.perm)
+			}
+			if tt.claims != nil && resp.Role != tt.claims.Role {
+				t.Errorf("got role %q, want %q", resp.Role, tt.claims.Role)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// CSRFCookieName holds the double-submit token the dashboard echoes in
+	// the CSRFHeader of state-changing requests.
+	CSRFCookieName = "gamma_csrf"
+	CSRFHeader     = "X-CSRF-Token"
+
+	// sessionRefreshInterval limits how often an active session's expiry
+	// is pushed back and its cookie reissued.
+	sessionRefreshInterval = 5 * time.Minute
+)
+
+var errInvalidSession = errors.New("invalid session")
+
+// ErrRevoked is returned by Revalidate once the session or API key is no
+// longer active.
+var ErrRevoked = errors.New("credentials revoked")
+
+// IssueSession creates a session record for user, sets it as the
+// gamma_session cookie and sets the matching CSRF cookie and header. The
+// session starts in the first organization the user joined.
+func IssueSession(w http.ResponseWriter, r *http.Request, queries *db.Queries, user db.User) error {
+	orgs, err := queries.ListUserOrganizations(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	var orgID pgtype.UUID
+	if len(orgs) > 0 {
+		orgID = orgs[0].ID
+	}
+
+	session, err := queries.CreateSession(r.Context(), db.CreateSessionParams{
+		ID:        newUUID(),
+		UserID:    user.ID,
+		OrgID:     orgID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(TokenExp), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	return setSessionCookies(w, r, session, user)
+}
+
+func setSessionCookies(w http.ResponseWriter, r *http.Request, session db.Session, user db.User) error {
+	sessionID := uuid.UUID(session.ID.Bytes).String()
+	claims := &Claims{
+		UserID:   uuid.UUID(user.ID.Bytes).String(),
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			Subject:   uuid.UUID(user.ID.Bytes).String(),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt.Time),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		return err
+	}
+
+	secure := secureCookies(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    tokenString,
+		Expires:  session.ExpiresAt.Time,
+		HttpOnly: true,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   secure,
+	})
+
+	// Readable by the dashboard, which sends it back in CSRFHeader
+	csrf := csrfToken(sessionID)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrf,
+		Expires:  session.ExpiresAt.Time,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   secure,
+	})
+	w.Header().Set(CSRFHeader, csrf)
+	return nil
+}
+
+func clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{CookieName, CSRFCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Expires:  time.Now().Add(-1 * time.Hour),
+			HttpOnly: name == CookieName,
+			Path:     "/",
+			Secure:   secureCookies(r),
+		})
+	}
+}
+
+func parseSessionCookie(r *http.Request) (*Claims, error) {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	jwtKey := []byte(tools.GetEnv("SESSION_SECRET"))
+	tkn, err := jwt.ParseWithClaims(c.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !tkn.Valid || claims.UserID == "" || claims.ID == "" {
+		return nil, errInvalidSession
+	}
+	return claims, nil
+}
+
+// authenticateSession validates the session cookie against its server-side
+// record, so revoked sessions and disabled users are rejected and role
+// changes apply immediately. The role is the user's role in the session's
+// organization. Active sessions are extended up to
+// SessionMaxExp.
+func (h *Handler) authenticateSession(w http.ResponseWriter, r *http.Request) (*Claims, error) {
+	claims, err := parseSessionCookie(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID pgtype.UUID
+	if err := sessionID.Scan(claims.ID); err != nil {
+		return nil, errInvalidSession
+	}
+
+	row, err := h.loadSession(r.Context(), claims, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(row.Session.LastSeenAt.Time) > sessionRefreshInterval {
+		h.refreshSession(w, r, row.Session, row.User)
+	}
+	return claims, nil
+}
+
+// loadSession reads the active session and fills claims with the user's
+// name and their organization and role in it.
+func (h *Handler) loadSession(ctx context.Context, claims *Claims, sessionID pgtype.UUID) (db.GetActiveSessionRow, error) {
+	row, err := h.Queries.GetActiveSession(ctx, sessionID)
+	if err != nil {
+		return row, errInvalidSession
+	}
+	if row.User.Disabled {
+		return row, errInvalidSession
+	}
+
+	claims.Username = row.User.Username
+	claims.OrgID = ""
+	claims.Role = ""
+	if row.Session.OrgID.Valid {
+		member, err := h.Queries.GetOrganizationMember(ctx, db.GetOrganizationMemberParams{
+			OrgID:  row.Session.OrgID,
+			UserID: row.User.ID,
+		})
+		switch {
+		case err == nil:
+			claims.OrgID = uuid.UUID(row.Session.OrgID.Bytes).String()
+			claims.Role = string(member.Role)
+		case err != pgx.ErrNoRows:
+			return row, err
+		}
+	}
+	return row, nil
+}
+
+// Revalidate checks that the session or API key behind claims is still
+// active, for connections that outlive the request that authenticated
+// them. It returns fresh claims with the current organization and role,
+// or ErrRevoked.
+func (h *Handler) Revalidate(ctx context.Context, claims *Claims) (*Claims, error) {
+	fresh := *claims
+	if claims.APIKeyID != "" {
+		var id pgtype.UUID
+		id.Scan(claims.APIKeyID)
+		apiKey, err := h.Queries.GetApiKey(ctx, id)
+		if err == pgx.ErrNoRows {
+			return nil, ErrRevoked
+		}
+		if err != nil {
+			return nil, err
+		}
+		if apiKey.RevokedAt.Valid || (apiKey.ExpiresAt.Valid && time.Now().After(apiKey.ExpiresAt.Time)) {
+			return nil, ErrRevoked
+		}
+		return &fresh, nil
+	}
+
+	var sessionID pgtype.UUID
+	if err := sessionID.Scan(claims.ID); err != nil {
+		return nil, ErrRevoked
+	}
+	if _, err := h.loadSession(ctx, &fresh, sessionID); err != nil {
+		if err == errInvalidSession {
+			return nil, ErrRevoked
+		}
+		return nil, err
+	}
+	return &fresh, nil
+}
+
+// refreshSession slides the session's expiry forward and reissues its
+// cookies. Failures are ignored: the current cookie stays valid.
+func (h *Handler) refreshSession(w http.ResponseWriter, r *http.Request, session db.Session, user db.User) {
+	expiresAt := time.Now().Add(TokenExp)
+	if maxExp := session.CreatedAt.Time.Add(SessionMaxExp); expiresAt.After(maxExp) {
+		expiresAt = maxExp
+	}
+	session.ExpiresAt = pgtype.Timestamptz{Time: expiresAt, Valid: true}
+
+	err := h.Queries.TouchSession(r.Context(), db.TouchSessionParams{
+		ID:        session.ID,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return
+	}
+	setSessionCookies(w, r, session, user)
+}
+
+// csrfToken derives the CSRF token from the session ID, so it needs no
+// storage and cannot be reused with another session.
+func csrfToken(sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(tools.GetEnv("SESSION_SECRET")))
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRF implements the double-submit check: the header must match the
+// cookie, and both must belong to the session.
+func validCSRF(r *http.Request, sessionID string) bool {
+	header := r.Header.Get(CSRFHeader)
+	c, err := r.Cookie(CSRFCookieName)
+	if err != nil || header == "" {
+		return false
+	}
+
+	expected := csrfToken(sessionID)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(expected)) == 1
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// secureCookies reports whether cookies should carry the Secure flag:
+// always when COOKIE_SECURE=true, otherwise when the request came over TLS
+// directly or through a proxy setting X-Forwarded-Proto.
+func secureCookies(r *http.Request) bool {
+	if os.Getenv("COOKIE_SECURE") == "true" {
+		return true
+	}
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions returns the signed-in user's active sessions.
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.Queries.ListUserSessions(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list sessions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	claims, _ := ClaimsFromContext(r.Context())
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		id := uuid.UUID(s.ID.Bytes).String()
+		resp = append(resp, SessionResponse{
+			ID:         id,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+			CreatedAt:  s.CreatedAt.Time,
+			LastSeenAt: s.LastSeenAt.Time,
+			ExpiresAt:  s.ExpiresAt.Time,
+			Current:    id == claims.ID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession signs the user out of one of their sessions.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	var userID pgtype.UUID
+	if err := userID.Scan(UserID(r.Context())); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := h.Queries.RevokeSession(r.Context(), db.RevokeSessionParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if claims, ok := ClaimsFromContext(r.Context()); ok && claims.ID == chi.URLParam(r, "id") {
+		clearSessionCookies(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutEverywhere revokes all of the user's sessions, including the
+// current one.
+func (h *Handler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	var userID pgtype.UUID
+	if err := userID.Scan(UserID(r.Context())); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Queries.RevokeUserSessions(r.Context(), userID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke sessions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	clearSessionCookies(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidCSRF(t *testing.T) {
+	t.Setenv("SESSION_SECRET", "test-secret")
+
+	const sessionID = "5b2f0d1e-8c3a-4f6b-9e7d-1a2b3c4d5e6f"
+	token := csrfToken(sessionID)
+	otherToken := csrfToken("0e9d8c7b-6a5f-4e3d-2c1b-0a9f8e7d6c5b")
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   bool
+	}{
+		{"header and cookie match the session", token, token, true},
+		{"no header", "", token, false},
+		{"no cookie", token, "", false},
+		{"neither", "", "", false},
+		{"header differs from cookie", token, otherToken, false},
+		{"cookie differs from header", otherToken, token, false},
+		{"both belong to another session", otherToken, otherToken, false},
+		{"both forged", "forged", "forged", false},
+		{"truncated", token[:len(token)-1], token[:len(token)-1], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/assets", nil)
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+			if got := validCSRF(r, sessionID); got != tt.want {
+				t.Errorf("validCSRF() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenDependsOnSecret(t *testing.T) {
+	const sessionID = "5b2f0d1e-8c3a-4f6b-9e7d-1a2b3c4d5e6f"
+
+	t.Setenv("SESSION_SECRET", "first-secret")
+	first := csrfToken(sessionID)
+	t.Setenv("SESSION_SECRET", "second-secret")
+	second := csrfToken(sessionID)
+
+	if first == second {
+		t.Error("csrfToken returned the same token for different secrets")
+	}
+}
+
+func TestSafeMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{http.MethodGet, true},
+		{http.MethodHead, true},
+		{http.MethodOptions, true},
+		{http.MethodPost, false},
+		{http.MethodPut, false},
+		{http.MethodPatch, false},
+		{http.MethodDelete, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := safeMethod(tt.method); got != tt.want {
+				t.Errorf("safeMethod(%s) = %v, want %v", tt.method, got, tt.want)
+			}
+		})
+	}
+}
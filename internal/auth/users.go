@@ -0,0 +1,577 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	InviteExp        = 7 * 24 * time.Hour
+	PasswordResetExp = 1 * time.Hour
+)
+
+// RegisterRoutes registers the routes for the signed-in user and user
+// administration. They must be mounted behind Middleware.
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Get("/auth/me", h.Me)
+	r.Post("/auth/password", h.ChangePassword)
+	r.Get("/auth/sessions", h.ListSessions)
+	r.Delete("/auth/sessions/{id}", h.RevokeSession)
+	r.Post("/auth/logout-all", h.LogoutEverywhere)
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireOrg, Require(PermUsersManage))
+		r.Get("/admin/users", h.ListUsers)
+		r.Post("/admin/users", h.InviteUser)
+		r.Put("/admin/users/{id}/role", h.SetRole)
+		r.Post("/admin/users/{id}/disable", h.DisableUser)
+		r.Post("/admin/users/{id}/enable", h.EnableUser)
+		r.Post("/admin/users/{id}/password-reset", h.CreatePasswordReset)
+	})
+
+	r.Post("/auth/org", h.SwitchOrg)
+
+	r.Group(func(r chi.Router) {
+		r.Use(Require(PermOrgsManage))
+		r.Post("/orgs", h.CreateOrg)
+		r.Get("/orgs/{id}/members", h.ListOrgMembers)
+		r.Put("/orgs/{id}/members/{userId}", h.AddOrgMember)
+		r.Delete("/orgs/{id}/members/{userId}", h.RemoveOrgMember)
+	})
+	r.Get("/orgs", h.ListOrgs)
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireOrg)
+		r.Get("/environments", h.ListEnvironments)
+		r.With(SelectEnvironment(h.Queries)).Get("/environment", h.GetEnvironment)
+		r.With(Require(PermOrgsManage)).Post("/environments", h.CreateEnvironment)
+		r.With(Require(PermOrgsManage), SelectEnvironment(h.Queries)).Put("/environment/settings", h.UpdateEnvironmentSettings)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(Require(PermAPIKeysManage), RequireOrg, SelectEnvironment(h.Queries))
+		r.Get("/api-keys", h.ListAPIKeys)
+		r.Post("/api-keys", h.CreateAPIKey)
+		r.Delete("/api-keys/{id}", h.RevokeAPIKey)
+		r.Get("/api-keys/{id}/audit", h.ListAPIKeyAudit)
+	})
+}
+
+type UserResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name"`
+	// Role is the user's role in the organization the request is scoped
+	// to, "" when none is selected.
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	Pending   bool      `json:"pending"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserResponse(u db.User, role db.UserRole) UserResponse {
+	return UserResponse{
+		ID:        uuid.UUID(u.ID.Bytes).String(),
+		Username:  u.Username,
+		Email:     u.Email.String,
+		Name:      u.Name,
+		Role:      string(role),
+		Disabled:  u.Disabled,
+		Pending:   !u.PasswordHash.Valid,
+		CreatedAt: u.CreatedAt.Time,
+	}
+}
+
+type MeResponse struct {
+	UserResponse
+	// OrgID is the organization currently selected, "" when none is.
+	OrgID         string        `json:"org_id"`
+	Organizations []OrgResponse `json:"organizations"`
+}
+
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	user, err := h.currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := h.Queries.ListUserOrganizations(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list organizations: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	claims, _ := ClaimsFromContext(r.Context())
+	resp := MeResponse{
+		UserResponse:  newUserResponse(user, db.UserRole(claims.Role)),
+		OrgID:         claims.OrgID,
+		Organizations: newOrgResponses(orgs, claims.OrgID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !user.PasswordHash.Valid || !CheckPassword(user.PasswordHash.String, req.CurrentPassword) {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	// Keep the session that changed the password and sign out the others
+	claims, _ := ClaimsFromContext(r.Context())
+	var sessionID pgtype.UUID
+	sessionID.Scan(claims.ID)
+	if !h.setPassword(w, r, user.ID, req.NewPassword, sessionID) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type RedeemTokenRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// AcceptInvite sets the first password of an invited user.
+func (h *Handler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	h.redeemToken(w, r, db.UserTokenPurposeInvite)
+}
+
+// ResetPassword sets a new password using a token issued by an admin.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	h.redeemToken(w, r, db.UserTokenPurposePasswordReset)
+}
+
+func (h *Handler) redeemToken(w http.ResponseWriter, r *http.Request, purpose db.UserTokenPurpose) {
+	var req RedeemTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < MinPasswordLength {
+		http.Error(w, fmt.Sprintf("password must be at least %d characters", MinPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Queries.ConsumeUserToken(r.Context(), db.ConsumeUserTokenParams{
+		TokenHash: hashToken(req.Token),
+		Purpose:   purpose,
+	})
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// A reset may follow a compromise, so sign out any existing session
+	if !h.setPassword(w, r, token.UserID, req.Password, pgtype.UUID{}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsers returns the members of the selected organization.
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	members, err := h.Queries.ListOrganizationMembers(r.Context(), OrgID(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list users: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]UserResponse, 0, len(members))
+	for _, m := range members {
+		resp = append(resp, newUserResponse(m.User, m.Role))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type InviteUserRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	// Role is the user's role in the selected organization, viewer by
+	// default.
+	Role db.UserRole `json:"role"`
+}
+
+type TokenResponse struct {
+	User      UserResponse `json:"user"`
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// InviteUser creates a user without a password in the selected
+// organization and returns the invite token they redeem at
+// POST /auth/invite/accept.
+func (h *Handler) InviteUser(w http.ResponseWriter, r *http.Request) {
+	var req InviteUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = db.UserRoleViewer
+	}
+	if !ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Queries.CreateUser(r.Context(), db.CreateUserParams{
+		ID:       newUUID(),
+		Username: req.Username,
+		Email:    pgtype.Text{String: req.Email, Valid: req.Email != ""},
+		Name:     req.Name,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "A user with this username or email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Invited users join the inviter's current organization
+	err = h.Queries.AddOrganizationMember(r.Context(), db.AddOrganizationMemberParams{
+		OrgID:  OrgID(r.Context()),
+		UserID: user.ID,
+		Role:   req.Role,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add user to organization: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	Audit(r.Context(), h.Queries, "user.invite", "user", uuid.UUID(user.ID.Bytes).String())
+	h.writeToken(w, r, user, req.Role, db.UserTokenPurposeInvite, InviteExp)
+}
+
+func (h *Handler) CreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	member, ok := h.findMember(w, r, id, true)
+	if !ok {
+		return
+	}
+
+	user, err := h.Queries.GetUser(r.Context(), id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	Audit(r.Context(), h.Queries, "user.password_reset", "user", uuid.UUID(user.ID.Bytes).String())
+	h.writeToken(w, r, user, member.Role, db.UserTokenPurposePasswordReset, PasswordResetExp)
+}
+
+// SetRoleRequest sets a user's role in the selected organization.
+type SetRoleRequest struct {
+	Role db.UserRole `json:"role"`
+}
+
+func (h *Handler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if uuid.UUID(id.Bytes).String() == UserID(r.Context()) && req.Role != db.UserRoleAdmin {
+		http.Error(w, "You cannot remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.findMember(w, r, id, false); !ok {
+		return
+	}
+
+	member, err := h.Queries.SetOrganizationMemberRole(r.Context(), db.SetOrganizationMemberRoleParams{
+		OrgID:  OrgID(r.Context()),
+		UserID: id,
+		Role:   req.Role,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.Queries.GetUser(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	Audit(r.Context(), h.Queries, "user.set_role", "user", uuid.UUID(user.ID.Bytes).String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user, member.Role))
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	if disabled && uuid.UUID(id.Bytes).String() == UserID(r.Context()) {
+		http.Error(w, "You cannot disable yourself", http.StatusBadRequest)
+		return
+	}
+
+	member, ok := h.findMember(w, r, id, true)
+	if !ok {
+		return
+	}
+
+	user, err := h.Queries.SetUserDisabled(r.Context(), db.SetUserDisabledParams{
+		ID:       id,
+		Disabled: disabled,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	action := "user.enable"
+	if disabled {
+		action = "user.disable"
+		if err := h.Queries.RevokeUserSessions(r.Context(), user.ID); err != nil {
+			log.Printf("Failed to revoke sessions of disabled user: %v", err)
+		}
+	}
+	Audit(r.Context(), h.Queries, action, "user", uuid.UUID(user.ID.Bytes).String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user, member.Role))
+}
+
+// findMember returns the membership of the user with the given ID in the
+// selected organization, answering 404 for users outside it. With account
+// set the action affects the whole account, e.g. its password, so the
+// caller must also manage users in every other organization the user
+// belongs to. Otherwise an admin of one organization could take over an
+// account another organization relies on.
+func (h *Handler) findMember(w http.ResponseWriter, r *http.Request, id pgtype.UUID, account bool) (db.OrganizationMember, bool) {
+	ctx := r.Context()
+	member, err := h.Queries.GetOrganizationMember(ctx, db.GetOrganizationMemberParams{
+		OrgID:  OrgID(ctx),
+		UserID: id,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return member, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return member, false
+	}
+	if !account {
+		return member, true
+	}
+
+	memberships, err := h.Queries.ListUserMemberships(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list memberships: %v", err), http.StatusInternalServerError)
+		return member, false
+	}
+	for _, m := range memberships {
+		manages, err := h.managesUsers(ctx, m.OrgID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+			return member, false
+		}
+		if !manages {
+			http.Error(w, "The user belongs to an organization whose users you do not manage", http.StatusForbidden)
+			return member, false
+		}
+	}
+	return member, true
+}
+
+// managesUsers reports whether the caller may manage the users of orgID.
+// API keys only manage their own organization.
+func (h *Handler) managesUsers(ctx context.Context, orgID pgtype.UUID) (bool, error) {
+	claims, _ := ClaimsFromContext(ctx)
+	if orgID == OrgID(ctx) {
+		return claims.Can(PermUsersManage), nil
+	}
+	if claims.APIKeyID != "" {
+		return false, nil
+	}
+
+	var userID pgtype.UUID
+	userID.Scan(claims.UserID)
+	m, err := h.Queries.GetOrganizationMember(ctx, db.GetOrganizationMemberParams{
+		OrgID:  orgID,
+		UserID: userID,
+	})
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return HasPermission(m.Role, PermUsersManage), nil
+}
+
+func (h *Handler) writeToken(w http.ResponseWriter, r *http.Request, user db.User, role db.UserRole, purpose db.UserTokenPurpose, exp time.Duration) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(exp)
+	err = h.Queries.CreateUserToken(r.Context(), db.CreateUserTokenParams{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TokenResponse{
+		User:      newUserResponse(user, role),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// setPassword sets the user's password, invalidates their outstanding
+// invite and reset tokens and revokes their sessions except keepSession,
+// all in one transaction. It writes the error response and returns false
+// on failure.
+func (h *Handler) setPassword(w http.ResponseWriter, r *http.Request, id pgtype.UUID, password string, keepSession pgtype.UUID) bool {
+	hash, err := HashPassword(password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	ctx := r.Context()
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		err := q.SetUserPassword(ctx, db.SetUserPasswordParams{
+			ID:           id,
+			PasswordHash: hash,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.RevokeUserTokens(ctx, id); err != nil {
+			return fmt.Errorf("revoke tokens: %w", err)
+		}
+		if !keepSession.Valid {
+			err = q.RevokeUserSessions(ctx, id)
+		} else {
+			err = q.RevokeOtherUserSessions(ctx, db.RevokeOtherUserSessionsParams{
+				UserID: id,
+				ID:     keepSession,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to set password: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) currentUser(r *http.Request) (db.User, error) {
+	var id pgtype.UUID
+	if err := id.Scan(UserID(r.Context())); err != nil {
+		return db.User{}, err
+	}
+	return h.Queries.GetUser(r.Context(), id)
+}
+
+func parseID(w http.ResponseWriter, r *http.Request) (pgtype.UUID, bool) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return id, false
+	}
+	return id, true
+}
@@ -7,30 +7,197 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const createAsset = `-- name: CreateAsset :one
-INSERT INTO assets (id, upload_id, hls_root, status)
-VALUES ($1, $2, $3, $4)
-RETURNING id, upload_id, hls_root, status, created_at, updated_at
+const copyAsset = `-- name: CopyAsset :one
+INSERT INTO assets (id, org_id, env_id, upload_id, hls_root, status, title, description, creator_id, external_id, metadata, tags, transcript, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme)
+SELECT $1::uuid, org_id, $2::uuid, upload_id, $3::text, status, title, description, creator_id, external_id, metadata, tags, transcript, id, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
+FROM assets
+WHERE assets.id = $4
+RETURNING id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
 `
 
-type CreateAssetParams struct {
+type CopyAssetParams struct {
 	ID       pgtype.UUID
-	UploadID pgtype.UUID
+	EnvID    pgtype.UUID
 	HlsRoot  string
-	Status   AssetStatus
+	SourceID pgtype.UUID
+}
+
+func (q *Queries) CopyAsset(ctx context.Context, arg CopyAssetParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, copyAsset,
+		arg.ID,
+		arg.EnvID,
+		arg.HlsRoot,
+		arg.SourceID,
+	)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
+	)
+	return i, err
+}
+
+const countAssets = `-- name: CountAssets :one
+SELECT COUNT(*) FROM assets
+WHERE org_id = $1
+    AND env_id = $2
+    AND ($3::asset_status IS NULL OR status = $3)
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at < $5)
+    AND ($6::text IS NULL OR creator_id = $6)
+    AND ($7::text IS NULL OR tags @> ARRAY[$7::text])
+    AND metadata @> $8
+    AND metadata ?& $9::text[]
+`
+
+type CountAssetsParams struct {
+	OrgID         pgtype.UUID
+	EnvID         pgtype.UUID
+	Status        NullAssetStatus
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	CreatorID     pgtype.Text
+	Tag           pgtype.Text
+	Metadata      json.RawMessage
+	Keys          []string
+}
+
+func (q *Queries) CountAssets(ctx context.Context, arg CountAssetsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countAssets,
+		arg.OrgID,
+		arg.EnvID,
+		arg.Status,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.CreatorID,
+		arg.Tag,
+		arg.Metadata,
+		arg.Keys,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countAssetsByHlsRoot = `-- name: CountAssetsByHlsRoot :one
+SELECT COUNT(*) FROM assets
+WHERE hls_root = $1
+`
+
+func (q *Queries) CountAssetsByHlsRoot(ctx context.Context, hlsRoot string) (int64, error) {
+	row := q.db.QueryRow(ctx, countAssetsByHlsRoot, hlsRoot)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAsset = `-- name: CreateAsset :one
+INSERT INTO assets (id, org_id, env_id, upload_id, hls_root, status, title, description, creator_id, external_id, metadata, tags, encrypted, drm_scheme)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+RETURNING id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
+`
+
+type CreateAssetParams struct {
+	ID          pgtype.UUID
+	OrgID       pgtype.UUID
+	EnvID       pgtype.UUID
+	UploadID    pgtype.UUID
+	HlsRoot     string
+	Status      AssetStatus
+	Title       string
+	Description pgtype.Text
+	CreatorID   pgtype.Text
+	ExternalID  pgtype.Text
+	Metadata    json.RawMessage
+	Tags        []string
+	Encrypted   bool
+	DrmScheme   pgtype.Text
 }
 
 func (q *Queries) CreateAsset(ctx context.Context, arg CreateAssetParams) (Asset, error) {
 	row := q.db.QueryRow(ctx, createAsset,
 		arg.ID,
+		arg.OrgID,
+		arg.EnvID,
 		arg.UploadID,
 		arg.HlsRoot,
 		arg.Status,
+		arg.Title,
+		arg.Description,
+		arg.CreatorID,
+		arg.ExternalID,
+		arg.Metadata,
+		arg.Tags,
+		arg.Encrypted,
+		arg.DrmScheme,
+	)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
 	)
+	return i, err
+}
+
+const deleteAsset = `-- name: DeleteAsset :one
+DELETE FROM assets
+WHERE id = $1 AND org_id = $2 AND env_id = $3
+RETURNING id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
+`
+
+type DeleteAssetParams struct {
+	ID    pgtype.UUID
+	OrgID pgtype.UUID
+	EnvID pgtype.UUID
+}
+
+func (q *Queries) DeleteAsset(ctx context.Context, arg DeleteAssetParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, deleteAsset, arg.ID, arg.OrgID, arg.EnvID)
 	var i Asset
 	err := row.Scan(
 		&i.ID,
@@ -39,17 +206,39 @@ func (q *Queries) CreateAsset(ctx context.Context, arg CreateAssetParams) (Asset
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
 	)
 	return i, err
 }
 
 const getAsset = `-- name: GetAsset :one
-SELECT id, upload_id, hls_root, status, created_at, updated_at FROM assets
-WHERE id = $1 LIMIT 1
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1
 `
 
-func (q *Queries) GetAsset(ctx context.Context, id pgtype.UUID) (Asset, error) {
-	row := q.db.QueryRow(ctx, getAsset, id)
+type GetAssetParams struct {
+	ID    pgtype.UUID
+	OrgID pgtype.UUID
+	EnvID pgtype.UUID
+}
+
+func (q *Queries) GetAsset(ctx context.Context, arg GetAssetParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, getAsset, arg.ID, arg.OrgID, arg.EnvID)
 	var i Asset
 	err := row.Scan(
 		&i.ID,
@@ -58,17 +247,170 @@ func (q *Queries) GetAsset(ctx context.Context, id pgtype.UUID) (Asset, error) {
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
+	)
+	return i, err
+}
+
+const getAssetByExternalID = `-- name: GetAssetByExternalID :one
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE org_id = $1 AND env_id = $2 AND external_id = $3 LIMIT 1
+`
+
+type GetAssetByExternalIDParams struct {
+	OrgID      pgtype.UUID
+	EnvID      pgtype.UUID
+	ExternalID pgtype.Text
+}
+
+func (q *Queries) GetAssetByExternalID(ctx context.Context, arg GetAssetByExternalIDParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, getAssetByExternalID, arg.OrgID, arg.EnvID, arg.ExternalID)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
 	)
 	return i, err
 }
 
 const getAssetByUploadID = `-- name: GetAssetByUploadID :one
-SELECT id, upload_id, hls_root, status, created_at, updated_at FROM assets
-WHERE upload_id = $1 LIMIT 1
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE upload_id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1
+`
+
+type GetAssetByUploadIDParams struct {
+	UploadID pgtype.UUID
+	OrgID    pgtype.UUID
+	EnvID    pgtype.UUID
+}
+
+func (q *Queries) GetAssetByUploadID(ctx context.Context, arg GetAssetByUploadIDParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, getAssetByUploadID, arg.UploadID, arg.OrgID, arg.EnvID)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
+	)
+	return i, err
+}
+
+const getReadyAsset = `-- name: GetReadyAsset :one
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE id = $1 AND status = 'ready' LIMIT 1
+`
+
+func (q *Queries) GetReadyAsset(ctx context.Context, id pgtype.UUID) (Asset, error) {
+	row := q.db.QueryRow(ctx, getReadyAsset, id)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
+	)
+	return i, err
+}
+
+const getReadyAssetByChecksum = `-- name: GetReadyAssetByChecksum :one
+SELECT assets.id, assets.upload_id, assets.hls_root, assets.status, assets.created_at, assets.updated_at, assets.title, assets.description, assets.creator_id, assets.external_id, assets.metadata, assets.tags, assets.transcript, assets.org_id, assets.env_id, assets.promoted_from, assets.visibility, assets.allowed_referrers, assets.token_ttl_seconds, assets.max_tokens, assets.encrypted, assets.drm_scheme FROM assets
+JOIN uploads ON uploads.id = assets.upload_id
+WHERE assets.org_id = $1 AND assets.env_id = $2 AND uploads.checksum_sha256 = $3 AND assets.encrypted = $4
+    AND assets.drm_scheme IS NOT DISTINCT FROM $5 AND assets.visibility = $6 AND assets.status = 'ready'
+ORDER BY assets.created_at
+LIMIT 1
 `
 
-func (q *Queries) GetAssetByUploadID(ctx context.Context, uploadID pgtype.UUID) (Asset, error) {
-	row := q.db.QueryRow(ctx, getAssetByUploadID, uploadID)
+type GetReadyAssetByChecksumParams struct {
+	OrgID          pgtype.UUID
+	EnvID          pgtype.UUID
+	ChecksumSha256 pgtype.Text
+	Encrypted      bool
+	DrmScheme      pgtype.Text
+	Visibility     AssetVisibility
+}
+
+func (q *Queries) GetReadyAssetByChecksum(ctx context.Context, arg GetReadyAssetByChecksumParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, getReadyAssetByChecksum,
+		arg.OrgID,
+		arg.EnvID,
+		arg.ChecksumSha256,
+		arg.Encrypted,
+		arg.DrmScheme,
+		arg.Visibility,
+	)
 	var i Asset
 	err := row.Scan(
 		&i.ID,
@@ -77,12 +419,42 @@ func (q *Queries) GetAssetByUploadID(ctx context.Context, uploadID pgtype.UUID)
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
 	)
 	return i, err
 }
 
+const isHlsRootPublic = `-- name: IsHlsRootPublic :one
+SELECT NOT EXISTS (
+    SELECT 1 FROM assets
+    WHERE hls_root = $1 AND visibility <> 'public'
+) AS public
+`
+
+func (q *Queries) IsHlsRootPublic(ctx context.Context, hlsRoot string) (bool, error) {
+	row := q.db.QueryRow(ctx, isHlsRootPublic, hlsRoot)
+	var public bool
+	err := row.Scan(&public)
+	return public, err
+}
+
 const listAssets = `-- name: ListAssets :many
-SELECT id, upload_id, hls_root, status, created_at, updated_at FROM assets
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
 ORDER BY created_at DESC
 `
 
@@ -102,6 +474,22 @@ func (q *Queries) ListAssets(ctx context.Context) ([]Asset, error) {
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Title,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.Transcript,
+			&i.OrgID,
+			&i.EnvID,
+			&i.PromotedFrom,
+			&i.Visibility,
+			&i.AllowedReferrers,
+			&i.TokenTtlSeconds,
+			&i.MaxTokens,
+			&i.Encrypted,
+			&i.DrmScheme,
 		); err != nil {
 			return nil, err
 		}
@@ -113,11 +501,365 @@ func (q *Queries) ListAssets(ctx context.Context) ([]Asset, error) {
 	return items, nil
 }
 
+const listAssetsByOrg = `-- name: ListAssetsByOrg :many
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE org_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListAssetsByOrg(ctx context.Context, orgID pgtype.UUID) ([]Asset, error) {
+	rows, err := q.db.Query(ctx, listAssetsByOrg, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Asset
+	for rows.Next() {
+		var i Asset
+		if err := rows.Scan(
+			&i.ID,
+			&i.UploadID,
+			&i.HlsRoot,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.Transcript,
+			&i.OrgID,
+			&i.EnvID,
+			&i.PromotedFrom,
+			&i.Visibility,
+			&i.AllowedReferrers,
+			&i.TokenTtlSeconds,
+			&i.MaxTokens,
+			&i.Encrypted,
+			&i.DrmScheme,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAssetsPage = `-- name: ListAssetsPage :many
+SELECT id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme FROM assets
+WHERE org_id = $1
+    AND env_id = $2
+    AND ($3::asset_status IS NULL OR status = $3)
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at < $5)
+    AND ($6::text IS NULL OR creator_id = $6)
+    AND ($7::text IS NULL OR tags @> ARRAY[$7::text])
+    AND metadata @> $8
+    AND metadata ?& $9::text[]
+    AND (
+        $10::timestamptz IS NULL
+        OR ($11::boolean
+            AND (CASE WHEN $12::text = 'updated_at' THEN updated_at ELSE created_at END, id) < ($10, $13::uuid))
+        OR (NOT $11
+            AND (CASE WHEN $12 = 'updated_at' THEN updated_at ELSE created_at END, id) > ($10, $13))
+    )
+ORDER BY
+    CASE WHEN $11 THEN (CASE WHEN $12 = 'updated_at' THEN updated_at ELSE created_at END) END DESC,
+    CASE WHEN $11 THEN id END DESC,
+    CASE WHEN NOT $11 THEN (CASE WHEN $12 = 'updated_at' THEN updated_at ELSE created_at END) END ASC,
+    CASE WHEN NOT $11 THEN id END ASC
+LIMIT $14
+`
+
+type ListAssetsPageParams struct {
+	OrgID         pgtype.UUID
+	EnvID         pgtype.UUID
+	Status        NullAssetStatus
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	CreatorID     pgtype.Text
+	Tag           pgtype.Text
+	Metadata      json.RawMessage
+	Keys          []string
+	CursorTime    pgtype.Timestamptz
+	SortDesc      bool
+	SortBy        string
+	CursorID      pgtype.UUID
+	Limit         int32
+}
+
+func (q *Queries) ListAssetsPage(ctx context.Context, arg ListAssetsPageParams) ([]Asset, error) {
+	rows, err := q.db.Query(ctx, listAssetsPage,
+		arg.OrgID,
+		arg.EnvID,
+		arg.Status,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.CreatorID,
+		arg.Tag,
+		arg.Metadata,
+		arg.Keys,
+		arg.CursorTime,
+		arg.SortDesc,
+		arg.SortBy,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Asset
+	for rows.Next() {
+		var i Asset
+		if err := rows.Scan(
+			&i.ID,
+			&i.UploadID,
+			&i.HlsRoot,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.Transcript,
+			&i.OrgID,
+			&i.EnvID,
+			&i.PromotedFrom,
+			&i.Visibility,
+			&i.AllowedReferrers,
+			&i.TokenTtlSeconds,
+			&i.MaxTokens,
+			&i.Encrypted,
+			&i.DrmScheme,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPublicAssetRoots = `-- name: ListPublicAssetRoots :many
+SELECT hls_root FROM assets
+GROUP BY hls_root
+HAVING bool_and(visibility = 'public') AND bool_or(status = 'ready')
+ORDER BY hls_root
+`
+
+func (q *Queries) ListPublicAssetRoots(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, listPublicAssetRoots)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var hls_root string
+		if err := rows.Scan(&hls_root); err != nil {
+			return nil, err
+		}
+		items = append(items, hls_root)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchAssets = `-- name: SearchAssets :many
+SELECT assets.id, assets.upload_id, assets.hls_root, assets.status, assets.created_at, assets.updated_at, assets.title, assets.description, assets.creator_id, assets.external_id, assets.metadata, assets.tags, assets.transcript, assets.org_id, assets.env_id, assets.promoted_from, assets.visibility, assets.allowed_referrers, assets.token_ttl_seconds, assets.max_tokens, assets.encrypted, assets.drm_scheme,
+    ts_rank_cd(asset_search.document, to_tsquery('simple', $1)) AS rank,
+    ts_headline('simple', translate(assets.title, U&'\E000\E001', ''), to_tsquery('simple', $1), U&'StartSel="\E000", StopSel="\E001", HighlightAll=true') AS title_highlight,
+    ts_headline('simple', translate(coalesce(assets.description, '') || ' ' || coalesce(assets.transcript, ''), U&'\E000\E001', ''), to_tsquery('simple', $1), U&'StartSel="\E000", StopSel="\E001", MaxFragments=2') AS snippet
+FROM assets
+JOIN asset_search ON asset_search.asset_id = assets.id
+WHERE assets.org_id = $2
+    AND assets.env_id = $3
+    AND asset_search.document @@ to_tsquery('simple', $1)
+ORDER BY rank DESC, assets.created_at DESC
+LIMIT $4 OFFSET $5
+`
+
+type SearchAssetsParams struct {
+	Query  string
+	OrgID  pgtype.UUID
+	EnvID  pgtype.UUID
+	Limit  int32
+	Offset int32
+}
+
+type SearchAssetsRow struct {
+	Asset          Asset
+	Rank           float32
+	TitleHighlight string
+	Snippet        string
+}
+
+func (q *Queries) SearchAssets(ctx context.Context, arg SearchAssetsParams) ([]SearchAssetsRow, error) {
+	rows, err := q.db.Query(ctx, searchAssets,
+		arg.Query,
+		arg.OrgID,
+		arg.EnvID,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchAssetsRow
+	for rows.Next() {
+		var i SearchAssetsRow
+		if err := rows.Scan(
+			&i.Asset.ID,
+			&i.Asset.UploadID,
+			&i.Asset.HlsRoot,
+			&i.Asset.Status,
+			&i.Asset.CreatedAt,
+			&i.Asset.UpdatedAt,
+			&i.Asset.Title,
+			&i.Asset.Description,
+			&i.Asset.CreatorID,
+			&i.Asset.ExternalID,
+			&i.Asset.Metadata,
+			&i.Asset.Tags,
+			&i.Asset.Transcript,
+			&i.Asset.OrgID,
+			&i.Asset.EnvID,
+			&i.Asset.PromotedFrom,
+			&i.Asset.Visibility,
+			&i.Asset.AllowedReferrers,
+			&i.Asset.TokenTtlSeconds,
+			&i.Asset.MaxTokens,
+			&i.Asset.Encrypted,
+			&i.Asset.DrmScheme,
+			&i.Rank,
+			&i.TitleHighlight,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateAssetMetadata = `-- name: UpdateAssetMetadata :one
+UPDATE assets
+SET title = COALESCE($1, title),
+    description = CASE WHEN $2::boolean THEN $3 ELSE description END,
+    creator_id = CASE WHEN $4::boolean THEN $5 ELSE creator_id END,
+    external_id = CASE WHEN $6::boolean THEN $7 ELSE external_id END,
+    metadata = COALESCE($8, metadata),
+    tags = CASE WHEN $9::boolean THEN COALESCE($10::text[], '{}') ELSE tags END,
+    transcript = CASE WHEN $11::boolean THEN $12 ELSE transcript END,
+    visibility = COALESCE($13::asset_visibility, visibility),
+    allowed_referrers = CASE WHEN $14::boolean THEN COALESCE($15::text[], '{}') ELSE allowed_referrers END,
+    token_ttl_seconds = CASE WHEN $16::boolean THEN COALESCE($17::integer, 0) ELSE token_ttl_seconds END,
+    max_tokens = CASE WHEN $18::boolean THEN COALESCE($19::integer, 0) ELSE max_tokens END,
+    updated_at = NOW()
+WHERE id = $20 AND org_id = $21 AND env_id = $22
+RETURNING id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
+`
+
+type UpdateAssetMetadataParams struct {
+	Title               pgtype.Text
+	SetDescription      bool
+	Description         pgtype.Text
+	SetCreatorID        bool
+	CreatorID           pgtype.Text
+	SetExternalID       bool
+	ExternalID          pgtype.Text
+	Metadata            []byte
+	SetTags             bool
+	Tags                []string
+	SetTranscript       bool
+	Transcript          pgtype.Text
+	Visibility          NullAssetVisibility
+	SetAllowedReferrers bool
+	AllowedReferrers    []string
+	SetTokenTtlSeconds  bool
+	TokenTtlSeconds     pgtype.Int4
+	SetMaxTokens        bool
+	MaxTokens           pgtype.Int4
+	ID                  pgtype.UUID
+	OrgID               pgtype.UUID
+	EnvID               pgtype.UUID
+}
+
+func (q *Queries) UpdateAssetMetadata(ctx context.Context, arg UpdateAssetMetadataParams) (Asset, error) {
+	row := q.db.QueryRow(ctx, updateAssetMetadata,
+		arg.Title,
+		arg.SetDescription,
+		arg.Description,
+		arg.SetCreatorID,
+		arg.CreatorID,
+		arg.SetExternalID,
+		arg.ExternalID,
+		arg.Metadata,
+		arg.SetTags,
+		arg.Tags,
+		arg.SetTranscript,
+		arg.Transcript,
+		arg.Visibility,
+		arg.SetAllowedReferrers,
+		arg.AllowedReferrers,
+		arg.SetTokenTtlSeconds,
+		arg.TokenTtlSeconds,
+		arg.SetMaxTokens,
+		arg.MaxTokens,
+		arg.ID,
+		arg.OrgID,
+		arg.EnvID,
+	)
+	var i Asset
+	err := row.Scan(
+		&i.ID,
+		&i.UploadID,
+		&i.HlsRoot,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
+	)
+	return i, err
+}
+
 const updateAssetStatus = `-- name: UpdateAssetStatus :one
 UPDATE assets
 SET status = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, upload_id, hls_root, status, created_at, updated_at
+RETURNING id, upload_id, hls_root, status, created_at, updated_at, title, description, creator_id, external_id, metadata, tags, transcript, org_id, env_id, promoted_from, visibility, allowed_referrers, token_ttl_seconds, max_tokens, encrypted, drm_scheme
 `
 
 type UpdateAssetStatusParams struct {
@@ -135,6 +877,22 @@ func (q *Queries) UpdateAssetStatus(ctx context.Context, arg UpdateAssetStatusPa
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Title,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.Transcript,
+		&i.OrgID,
+		&i.EnvID,
+		&i.PromotedFrom,
+		&i.Visibility,
+		&i.AllowedReferrers,
+		&i.TokenTtlSeconds,
+		&i.MaxTokens,
+		&i.Encrypted,
+		&i.DrmScheme,
 	)
 	return i, err
 }
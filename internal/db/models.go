@@ -6,6 +6,7 @@ package db
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgtype"
@@ -54,6 +55,49 @@ func (ns NullAssetStatus) Value() (driver.Value, error) {
 	return string(ns.AssetStatus), nil
 }
 
+type AssetVisibility string
+
+const (
+	AssetVisibilityPublic   AssetVisibility = "public"
+	AssetVisibilityUnlisted AssetVisibility = "unlisted"
+	AssetVisibilityPrivate  AssetVisibility = "private"
+)
+
+func (e *AssetVisibility) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AssetVisibility(s)
+	case string:
+		*e = AssetVisibility(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AssetVisibility: %T", src)
+	}
+	return nil
+}
+
+type NullAssetVisibility struct {
+	AssetVisibility AssetVisibility
+	Valid           bool // Valid is true if AssetVisibility is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAssetVisibility) Scan(value interface{}) error {
+	if value == nil {
+		ns.AssetVisibility, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AssetVisibility.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAssetVisibility) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AssetVisibility), nil
+}
+
 type UploadStatus string
 
 const (
@@ -99,20 +143,317 @@ func (ns NullUploadStatus) Value() (driver.Value, error) {
 	return string(ns.UploadStatus), nil
 }
 
+type UserRole string
+
+const (
+	UserRoleAdmin    UserRole = "admin"
+	UserRoleEditor   UserRole = "editor"
+	UserRoleViewer   UserRole = "viewer"
+	UserRoleUploader UserRole = "uploader"
+)
+
+func (e *UserRole) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = UserRole(s)
+	case string:
+		*e = UserRole(s)
+	default:
+		return fmt.Errorf("unsupported scan type for UserRole: %T", src)
+	}
+	return nil
+}
+
+type NullUserRole struct {
+	UserRole UserRole
+	Valid    bool // Valid is true if UserRole is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullUserRole) Scan(value interface{}) error {
+	if value == nil {
+		ns.UserRole, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.UserRole.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullUserRole) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.UserRole), nil
+}
+
+type UserTokenPurpose string
+
+const (
+	UserTokenPurposeInvite        UserTokenPurpose = "invite"
+	UserTokenPurposePasswordReset UserTokenPurpose = "password_reset"
+)
+
+func (e *UserTokenPurpose) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = UserTokenPurpose(s)
+	case string:
+		*e = UserTokenPurpose(s)
+	default:
+		return fmt.Errorf("unsupported scan type for UserTokenPurpose: %T", src)
+	}
+	return nil
+}
+
+type NullUserTokenPurpose struct {
+	UserTokenPurpose UserTokenPurpose
+	Valid            bool // Valid is true if UserTokenPurpose is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullUserTokenPurpose) Scan(value interface{}) error {
+	if value == nil {
+		ns.UserTokenPurpose, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.UserTokenPurpose.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullUserTokenPurpose) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.UserTokenPurpose), nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+func (e *WebhookDeliveryStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = WebhookDeliveryStatus(s)
+	case string:
+		*e = WebhookDeliveryStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for WebhookDeliveryStatus: %T", src)
+	}
+	return nil
+}
+
+type NullWebhookDeliveryStatus struct {
+	WebhookDeliveryStatus WebhookDeliveryStatus
+	Valid                 bool // Valid is true if WebhookDeliveryStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullWebhookDeliveryStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.WebhookDeliveryStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.WebhookDeliveryStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullWebhookDeliveryStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.WebhookDeliveryStatus), nil
+}
+
+type ApiKey struct {
+	ID         pgtype.UUID
+	Name       string
+	Prefix     string
+	SecretHash string
+	Scopes     []string
+	CreatedBy  pgtype.UUID
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+	CreatedAt  pgtype.Timestamptz
+	OrgID      pgtype.UUID
+	EnvID      pgtype.UUID
+}
+
 type Asset struct {
+	ID               pgtype.UUID
+	UploadID         pgtype.UUID
+	HlsRoot          string
+	Status           AssetStatus
+	CreatedAt        pgtype.Timestamptz
+	UpdatedAt        pgtype.Timestamptz
+	Title            string
+	Description      pgtype.Text
+	CreatorID        pgtype.Text
+	ExternalID       pgtype.Text
+	Metadata         json.RawMessage
+	Tags             []string
+	Transcript       pgtype.Text
+	OrgID            pgtype.UUID
+	EnvID            pgtype.UUID
+	PromotedFrom     pgtype.UUID
+	Visibility       AssetVisibility
+	AllowedReferrers []string
+	TokenTtlSeconds  int32
+	MaxTokens        int32
+	Encrypted        bool
+	DrmScheme        pgtype.Text
+}
+
+type AssetKey struct {
+	AssetID   pgtype.UUID
+	KeyIndex  int32
+	SealedKey []byte
+	CreatedAt pgtype.Timestamptz
+	KeyID     []byte
+}
+
+type AssetSearch struct {
+	AssetID  pgtype.UUID
+	Document interface{}
+}
+
+type AuditLog struct {
+	ID           int64
+	UserID       pgtype.UUID
+	ApiKeyID     pgtype.UUID
+	Action       string
+	ResourceType string
+	ResourceID   string
+	CreatedAt    pgtype.Timestamptz
+}
+
+type Environment struct {
 	ID        pgtype.UUID
-	UploadID  pgtype.UUID
-	HlsRoot   string
-	Status    AssetStatus
+	OrgID     pgtype.UUID
+	Name      string
+	Settings  []byte
 	CreatedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
 }
 
-type Upload struct {
+type Organization struct {
 	ID        pgtype.UUID
-	Title     string
-	S3Key     string
-	Status    UploadStatus
+	Slug      string
+	Name      string
 	CreatedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
+}
+
+type OrganizationMember struct {
+	OrgID     pgtype.UUID
+	UserID    pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+	Role      UserRole
+}
+
+type Outbox struct {
+	ID          pgtype.UUID
+	Subject     string
+	Payload     []byte
+	Attempts    int32
+	LastError   pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+	PublishedAt pgtype.Timestamptz
+}
+
+type PlaybackToken struct {
+	ID        pgtype.UUID
+	AssetID   pgtype.UUID
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type Session struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  pgtype.Timestamptz
+	LastSeenAt pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+	OrgID      pgtype.UUID
+}
+
+type Upload struct {
+	ID             pgtype.UUID
+	Title          string
+	S3Key          string
+	Status         UploadStatus
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	ChecksumSha256 pgtype.Text
+	Deduplicate    bool
+	Description    pgtype.Text
+	CreatorID      pgtype.Text
+	ExternalID     pgtype.Text
+	Metadata       json.RawMessage
+	Tags           []string
+	OrgID          pgtype.UUID
+	EnvID          pgtype.UUID
+	Encrypt        bool
+	DrmScheme      pgtype.Text
+	EnqueuedAt     pgtype.Timestamptz
+}
+
+type User struct {
+	ID           pgtype.UUID
+	Username     string
+	Email        pgtype.Text
+	Name         string
+	PasswordHash pgtype.Text
+	Disabled     bool
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
+	OidcIssuer   pgtype.Text
+	OidcSubject  pgtype.Text
+}
+
+type UserToken struct {
+	TokenHash string
+	UserID    pgtype.UUID
+	Purpose   UserTokenPurpose
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type WebhookDelivery struct {
+	ID             pgtype.UUID
+	EndpointID     pgtype.UUID
+	EventID        pgtype.UUID
+	EventType      string
+	Payload        []byte
+	Status         WebhookDeliveryStatus
+	Attempts       int32
+	ResponseStatus pgtype.Int4
+	LastError      pgtype.Text
+	NextAttemptAt  pgtype.Timestamptz
+	RedeliveryOf   pgtype.UUID
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	DeliveredAt    pgtype.Timestamptz
+}
+
+type WebhookEndpoint struct {
+	ID          pgtype.UUID
+	OrgID       pgtype.UUID
+	EnvID       pgtype.UUID
+	Url         string
+	Secret      string
+	EventTypes  []string
+	Description pgtype.Text
+	CreatedBy   pgtype.UUID
+	CreatedAt   pgtype.Timestamptz
 }
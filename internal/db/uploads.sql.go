@@ -7,29 +7,86 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countUploads = `-- name: CountUploads :one
+SELECT COUNT(*) FROM uploads
+WHERE org_id = $1
+    AND env_id = $2
+    AND ($3::upload_status IS NULL OR status = $3)
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at < $5)
+    AND ($6::text IS NULL OR creator_id = $6)
+    AND ($7::text IS NULL OR tags @> ARRAY[$7::text])
+`
+
+type CountUploadsParams struct {
+	OrgID         pgtype.UUID
+	EnvID         pgtype.UUID
+	Status        NullUploadStatus
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	CreatorID     pgtype.Text
+	Tag           pgtype.Text
+}
+
+func (q *Queries) CountUploads(ctx context.Context, arg CountUploadsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countUploads,
+		arg.OrgID,
+		arg.EnvID,
+		arg.Status,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.CreatorID,
+		arg.Tag,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUpload = `-- name: CreateUpload :one
-INSERT INTO uploads (id, title, s3_key, status)
-VALUES ($1, $2, $3, $4)
-RETURNING id, title, s3_key, status, created_at, updated_at
+INSERT INTO uploads (id, org_id, env_id, title, s3_key, status, deduplicate, description, creator_id, external_id, metadata, tags, encrypt, drm_scheme)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+RETURNING id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at
 `
 
 type CreateUploadParams struct {
-	ID     pgtype.UUID
-	Title  string
-	S3Key  string
-	Status UploadStatus
+	ID          pgtype.UUID
+	OrgID       pgtype.UUID
+	EnvID       pgtype.UUID
+	Title       string
+	S3Key       string
+	Status      UploadStatus
+	Deduplicate bool
+	Description pgtype.Text
+	CreatorID   pgtype.Text
+	ExternalID  pgtype.Text
+	Metadata    json.RawMessage
+	Tags        []string
+	Encrypt     bool
+	DrmScheme   pgtype.Text
 }
 
 func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error) {
 	row := q.db.QueryRow(ctx, createUpload,
 		arg.ID,
+		arg.OrgID,
+		arg.EnvID,
 		arg.Title,
 		arg.S3Key,
 		arg.Status,
+		arg.Deduplicate,
+		arg.Description,
+		arg.CreatorID,
+		arg.ExternalID,
+		arg.Metadata,
+		arg.Tags,
+		arg.Encrypt,
+		arg.DrmScheme,
 	)
 	var i Upload
 	err := row.Scan(
@@ -39,17 +96,35 @@ func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) (Upl
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ChecksumSha256,
+		&i.Deduplicate,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.OrgID,
+		&i.EnvID,
+		&i.Encrypt,
+		&i.DrmScheme,
+		&i.EnqueuedAt,
 	)
 	return i, err
 }
 
 const getUpload = `-- name: GetUpload :one
-SELECT id, title, s3_key, status, created_at, updated_at FROM uploads
-WHERE id = $1 LIMIT 1
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
+WHERE id = $1 AND org_id = $2 AND env_id = $3 LIMIT 1
 `
 
-func (q *Queries) GetUpload(ctx context.Context, id pgtype.UUID) (Upload, error) {
-	row := q.db.QueryRow(ctx, getUpload, id)
+type GetUploadParams struct {
+	ID    pgtype.UUID
+	OrgID pgtype.UUID
+	EnvID pgtype.UUID
+}
+
+func (q *Queries) GetUpload(ctx context.Context, arg GetUploadParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, getUpload, arg.ID, arg.OrgID, arg.EnvID)
 	var i Upload
 	err := row.Scan(
 		&i.ID,
@@ -58,12 +133,100 @@ func (q *Queries) GetUpload(ctx context.Context, id pgtype.UUID) (Upload, error)
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ChecksumSha256,
+		&i.Deduplicate,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.OrgID,
+		&i.EnvID,
+		&i.Encrypt,
+		&i.DrmScheme,
+		&i.EnqueuedAt,
 	)
 	return i, err
 }
 
+const getUploadByKey = `-- name: GetUploadByKey :one
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
+WHERE s3_key = $1 LIMIT 1
+`
+
+func (q *Queries) GetUploadByKey(ctx context.Context, s3Key string) (Upload, error) {
+	row := q.db.QueryRow(ctx, getUploadByKey, s3Key)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.S3Key,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ChecksumSha256,
+		&i.Deduplicate,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.OrgID,
+		&i.EnvID,
+		&i.Encrypt,
+		&i.DrmScheme,
+		&i.EnqueuedAt,
+	)
+	return i, err
+}
+
+const listStuckUploads = `-- name: ListStuckUploads :many
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
+WHERE status = 'processing' AND updated_at < $1
+ORDER BY updated_at
+`
+
+func (q *Queries) ListStuckUploads(ctx context.Context, updatedAt pgtype.Timestamptz) ([]Upload, error) {
+	rows, err := q.db.Query(ctx, listStuckUploads, updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Upload
+	for rows.Next() {
+		var i Upload
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.S3Key,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ChecksumSha256,
+			&i.Deduplicate,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.OrgID,
+			&i.EnvID,
+			&i.Encrypt,
+			&i.DrmScheme,
+			&i.EnqueuedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUploads = `-- name: ListUploads :many
-SELECT id, title, s3_key, status, created_at, updated_at FROM uploads
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
 ORDER BY created_at DESC
 `
 
@@ -83,6 +246,154 @@ func (q *Queries) ListUploads(ctx context.Context) ([]Upload, error) {
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ChecksumSha256,
+			&i.Deduplicate,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.OrgID,
+			&i.EnvID,
+			&i.Encrypt,
+			&i.DrmScheme,
+			&i.EnqueuedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUploadsByOrg = `-- name: ListUploadsByOrg :many
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
+WHERE org_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUploadsByOrg(ctx context.Context, orgID pgtype.UUID) ([]Upload, error) {
+	rows, err := q.db.Query(ctx, listUploadsByOrg, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Upload
+	for rows.Next() {
+		var i Upload
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.S3Key,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ChecksumSha256,
+			&i.Deduplicate,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.OrgID,
+			&i.EnvID,
+			&i.Encrypt,
+			&i.DrmScheme,
+			&i.EnqueuedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUploadsPage = `-- name: ListUploadsPage :many
+SELECT id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at FROM uploads
+WHERE org_id = $1
+    AND env_id = $2
+    AND ($3::upload_status IS NULL OR status = $3)
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at < $5)
+    AND ($6::text IS NULL OR creator_id = $6)
+    AND ($7::text IS NULL OR tags @> ARRAY[$7::text])
+    AND (
+        $8::timestamptz IS NULL
+        OR ($9::boolean
+            AND (CASE WHEN $10::text = 'updated_at' THEN updated_at ELSE created_at END, id) < ($8, $11::uuid))
+        OR (NOT $9
+            AND (CASE WHEN $10 = 'updated_at' THEN updated_at ELSE created_at END, id) > ($8, $11))
+    )
+ORDER BY
+    CASE WHEN $9 THEN (CASE WHEN $10 = 'updated_at' THEN updated_at ELSE created_at END) END DESC,
+    CASE WHEN $9 THEN id END DESC,
+    CASE WHEN NOT $9 THEN (CASE WHEN $10 = 'updated_at' THEN updated_at ELSE created_at END) END ASC,
+    CASE WHEN NOT $9 THEN id END ASC
+LIMIT $12
+`
+
+type ListUploadsPageParams struct {
+	OrgID         pgtype.UUID
+	EnvID         pgtype.UUID
+	Status        NullUploadStatus
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	CreatorID     pgtype.Text
+	Tag           pgtype.Text
+	CursorTime    pgtype.Timestamptz
+	SortDesc      bool
+	SortBy        string
+	CursorID      pgtype.UUID
+	Limit         int32
+}
+
+func (q *Queries) ListUploadsPage(ctx context.Context, arg ListUploadsPageParams) ([]Upload, error) {
+	rows, err := q.db.Query(ctx, listUploadsPage,
+		arg.OrgID,
+		arg.EnvID,
+		arg.Status,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.CreatorID,
+		arg.Tag,
+		arg.CursorTime,
+		arg.SortDesc,
+		arg.SortBy,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Upload
+	for rows.Next() {
+		var i Upload
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.S3Key,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ChecksumSha256,
+			&i.Deduplicate,
+			&i.Description,
+			&i.CreatorID,
+			&i.ExternalID,
+			&i.Metadata,
+			&i.Tags,
+			&i.OrgID,
+			&i.EnvID,
+			&i.Encrypt,
+			&i.DrmScheme,
+			&i.EnqueuedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -94,11 +405,79 @@ func (q *Queries) ListUploads(ctx context.Context) ([]Upload, error) {
 	return items, nil
 }
 
+const markUploadEnqueued = `-- name: MarkUploadEnqueued :exec
+UPDATE uploads
+SET enqueued_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) MarkUploadEnqueued(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markUploadEnqueued, id)
+	return err
+}
+
+const setUploadChecksum = `-- name: SetUploadChecksum :exec
+UPDATE uploads
+SET checksum_sha256 = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUploadChecksumParams struct {
+	ID             pgtype.UUID
+	ChecksumSha256 pgtype.Text
+}
+
+func (q *Queries) SetUploadChecksum(ctx context.Context, arg SetUploadChecksumParams) error {
+	_, err := q.db.Exec(ctx, setUploadChecksum, arg.ID, arg.ChecksumSha256)
+	return err
+}
+
+const transitionUploadStatusByKey = `-- name: TransitionUploadStatusByKey :one
+UPDATE uploads
+SET status = $1, updated_at = NOW()
+WHERE s3_key = $2
+    AND status::text = ANY($3::text[])
+    AND NOT EXISTS (SELECT 1 FROM assets WHERE assets.upload_id = uploads.id)
+RETURNING id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at
+`
+
+type TransitionUploadStatusByKeyParams struct {
+	Status       UploadStatus
+	S3Key        string
+	FromStatuses []string
+}
+
+func (q *Queries) TransitionUploadStatusByKey(ctx context.Context, arg TransitionUploadStatusByKeyParams) (Upload, error) {
+	row := q.db.QueryRow(ctx, transitionUploadStatusByKey, arg.Status, arg.S3Key, arg.FromStatuses)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.S3Key,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ChecksumSha256,
+		&i.Deduplicate,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.OrgID,
+		&i.EnvID,
+		&i.Encrypt,
+		&i.DrmScheme,
+		&i.EnqueuedAt,
+	)
+	return i, err
+}
+
 const updateUploadStatusByKey = `-- name: UpdateUploadStatusByKey :one
 UPDATE uploads
 SET status = $2, updated_at = NOW()
 WHERE s3_key = $1
-RETURNING id, title, s3_key, status, created_at, updated_at
+RETURNING id, title, s3_key, status, created_at, updated_at, checksum_sha256, deduplicate, description, creator_id, external_id, metadata, tags, org_id, env_id, encrypt, drm_scheme, enqueued_at
 `
 
 type UpdateUploadStatusByKeyParams struct {
@@ -116,6 +495,18 @@ func (q *Queries) UpdateUploadStatusByKey(ctx context.Context, arg UpdateUploadS
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ChecksumSha256,
+		&i.Deduplicate,
+		&i.Description,
+		&i.CreatorID,
+		&i.ExternalID,
+		&i.Metadata,
+		&i.Tags,
+		&i.OrgID,
+		&i.EnvID,
+		&i.Encrypt,
+		&i.DrmScheme,
+		&i.EnqueuedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpecVersion is the CloudEvents version events are serialized with.
+const SpecVersion = "1.0"
+
+// Sources identify the service an event originates from.
+const (
+	SourceAPI        = "/gamma/api"
+	SourceWorker     = "/gamma/worker"
+	SourceReconciler = "/gamma/reconciler"
+)
+
+// CloudEvent is the envelope of every event Gamma publishes, in the
+// CloudEvents 1.0 structured JSON format. Type names the payload and its
+// version; consumers decode Data with the matching struct.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+
+	// StreamSeq is the sequence of the event in its JetStream stream, set
+	// when it is delivered to WebSocket and SSE clients.
+	StreamSeq uint64 `json:"streamseq,omitempty"`
+}
+
+// Payload is the data of a typed event. Changing the fields of a payload
+// incompatibly requires a new struct with a new version in its type.
+type Payload interface {
+	EventType() string
+	EventSubject() string
+}
+
+// NewCloudEvent wraps data in an envelope from source.
+func NewCloudEvent(source string, data Payload) (CloudEvent, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return CloudEvent{}, fmt.Errorf("failed to encode %s event: %w", data.EventType(), err)
+	}
+	return CloudEvent{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            data.EventType(),
+		Subject:         data.EventSubject(),
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            body,
+	}, nil
+}
+
+// ParseCloudEvent decodes an envelope and checks its required attributes.
+func ParseCloudEvent(body []byte) (CloudEvent, error) {
+	var ce CloudEvent
+	if err := json.Unmarshal(body, &ce); err != nil {
+		return CloudEvent{}, fmt.Errorf("invalid event: %w", err)
+	}
+	if ce.SpecVersion != SpecVersion {
+		return CloudEvent{}, fmt.Errorf("unsupported specversion %q", ce.SpecVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return CloudEvent{}, fmt.Errorf("event lacks id, source or type")
+	}
+	return ce, nil
+}
+
+// DecodeData decodes the payload into v, which must be the struct for the
+// event's type.
+func (ce CloudEvent) DecodeData(v Payload) error {
+	if ce.Type != v.EventType() {
+		return fmt.Errorf("cannot decode %s event as %s", ce.Type, v.EventType())
+	}
+	return json.Unmarshal(ce.Data, v)
+}
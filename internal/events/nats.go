@@ -1,7 +1,10 @@
 package events
 
 import (
+	"context"
+	"encoding/json"
 	"log"
+	"slices"
 
 	"github.com/nats-io/nats.go"
 )
@@ -32,12 +35,58 @@ func (eb *EventBus) Publish(subject string, data []byte) error {
 	return err
 }
 
+// PublishWithID publishes with msgID as Nats-Msg-Id, so JetStream discards
+// a republished message within the stream's duplicate window.
+func (eb *EventBus) PublishWithID(subject string, data []byte, msgID string) error {
+	_, err := eb.js.Publish(subject, data, nats.MsgId(msgID))
+	return err
+}
+
+// PublishEvent publishes a typed event from source right away. Events
+// that must not be lost go through the outbox instead.
+func (eb *EventBus) PublishEvent(source string, data Payload) error {
+	event, err := NewCloudEvent(source, data)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return eb.Publish(Subject(event.Type), body)
+}
+
+// EnsureLifecycleStream creates the stream of upload and asset events.
+func (eb *EventBus) EnsureLifecycleStream() error {
+	return eb.EnsureStream(LifecycleStream, LifecycleSubjects)
+}
+
+// EnsureStream creates a stream, or adds subjects missing from an
+// existing one.
 func (eb *EventBus) EnsureStream(streamName string, subjects []string) error {
 	stream, err := eb.js.StreamInfo(streamName)
 	if err != nil && err != nats.ErrStreamNotFound {
 		return err
 	}
 
+	if stream != nil {
+		var missing []string
+		for _, subject := range subjects {
+			if !slices.Contains(stream.Config.Subjects, subject) {
+				missing = append(missing, subject)
+			}
+		}
+		if len(missing) > 0 {
+			// Keep the subjects other processes ensured on the stream
+			log.Printf("Adding subjects %v to stream %s", missing, streamName)
+			cfg := stream.Config
+			cfg.Subjects = append(slices.Clone(cfg.Subjects), missing...)
+			if _, err := eb.js.UpdateStream(&cfg); err != nil {
+				return err
+			}
+		}
+	}
+
 	if stream == nil {
 		log.Printf("Creating stream %s with subjects %v", streamName, subjects)
 		_, err = eb.js.AddStream(&nats.StreamConfig{
@@ -51,8 +100,68 @@ func (eb *EventBus) EnsureStream(streamName string, subjects []string) error {
 	return nil
 }
 
-func (eb *EventBus) Subscribe(subject, queueGroup string, handler nats.MsgHandler) (*nats.Subscription, error) {
-	return eb.js.QueueSubscribe(subject, queueGroup, handler, nats.Durable(queueGroup), nats.ManualAck())
+// Subscribe creates a durable queue subscription named after queueGroup
+// with manual acks. opts adds consumer options such as nats.AckWait.
+func (eb *EventBus) Subscribe(subject, queueGroup string, handler nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	opts = append([]nats.SubOpt{nats.Durable(queueGroup), nats.ManualAck()}, opts...)
+	return eb.js.QueueSubscribe(subject, queueGroup, handler, opts...)
+}
+
+// Fanout delivers every message stored in stream from now on to handler,
+// through an ephemeral ordered consumer of this process. Unlike Subscribe
+// it is not shared: every process calling it receives every message, and
+// nothing is acknowledged or redelivered. Use it to notify the clients
+// connected to this process, never for work that must happen once.
+func (eb *EventBus) Fanout(stream string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return eb.js.Subscribe("", handler, nats.BindStream(stream), nats.OrderedConsumer(), nats.DeliverNew())
+}
+
+// DeleteConsumer deletes a durable consumer that is no longer used. It is
+// not an error if the consumer does not exist.
+func (eb *EventBus) DeleteConsumer(stream, name string) error {
+	err := eb.js.DeleteConsumer(stream, name)
+	if err == nats.ErrConsumerNotFound {
+		return nil
+	}
+	return err
+}
+
+// Replay passes the messages of stream to fn in order, from sequence start
+// up to the last message stored when it is called, through an ephemeral
+// ordered consumer. Messages no longer retained are skipped, so the first
+// one passed may come after start.
+func (eb *EventBus) Replay(ctx context.Context, stream string, start uint64, fn func(msg *nats.Msg, seq uint64) error) error {
+	info, err := eb.js.StreamInfo(stream, nats.Context(ctx))
+	if err != nil {
+		return err
+	}
+	last := info.State.LastSeq
+	if start > last {
+		return nil
+	}
+
+	sub, err := eb.js.SubscribeSync("", nats.BindStream(stream), nats.OrderedConsumer(), nats.StartSequence(start))
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return err
+		}
+		if err := fn(msg, meta.Sequence.Stream); err != nil {
+			return err
+		}
+		if meta.Sequence.Stream >= last || meta.NumPending == 0 {
+			return nil
+		}
+	}
 }
 
 func (eb *EventBus) Close() {
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// schemas holds a JSON Schema per event type, plus "cloudevent" for the
+// envelope.
+//
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// SchemaIndex is the response of GET /events/schemas.
+type SchemaIndex struct {
+	Envelope string   `json:"envelope"`
+	Types    []string `json:"types"`
+}
+
+// RegisterSchemaRoutes publishes the event schemas. They are public: they
+// describe the contract, not any data.
+func RegisterSchemaRoutes(r chi.Router) {
+	r.Get("/events/schemas", ServeSchemaIndex)
+	r.Get("/events/schemas/{type}", ServeSchema)
+}
+
+// ServeSchemaIndex lists the event types with a schema.
+func ServeSchemaIndex(w http.ResponseWriter, r *http.Request) {
+	entries, err := schemas.ReadDir("schemas")
+	if err != nil {
+		http.Error(w, "Failed to list schemas", http.StatusInternalServerError)
+		return
+	}
+
+	index := SchemaIndex{Envelope: "cloudevent", Types: []string{}}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if name != index.Envelope {
+			index.Types = append(index.Types, name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index)
+}
+
+// ServeSchema serves the JSON Schema of an event type's data, or of the
+// envelope for "cloudevent".
+func ServeSchema(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "type")
+	if strings.ContainsAny(name, "/\\") {
+		http.Error(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+
+	body, err := schemas.ReadFile("schemas/" + name + ".json")
+	if err != nil {
+		http.Error(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(body)
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/google/uuid"
+)
+
+// Event types, versioned so that consumers keep working while a payload
+// changes: an incompatible change adds a new type next to the old one.
+const (
+	TypeUploadCreatedV1    = "gamma.upload.created.v1"
+	TypeUploadUploadedV1   = "gamma.upload.uploaded.v1"
+	TypeUploadProcessingV1 = "gamma.upload.processing.v1"
+	TypeUploadProgressV1   = "gamma.upload.progress.v1"
+	TypeUploadFailedV1     = "gamma.upload.failed.v1"
+	TypeAssetProcessedV1   = "gamma.asset.processed.v1"
+	TypeAssetDeletedV1     = "gamma.asset.deleted.v1"
+)
+
+// Types lists every event type.
+var Types = []string{
+	TypeUploadCreatedV1,
+	TypeUploadUploadedV1,
+	TypeUploadProcessingV1,
+	TypeUploadProgressV1,
+	TypeUploadFailedV1,
+	TypeAssetProcessedV1,
+	TypeAssetDeletedV1,
+}
+
+// LifecycleStream holds every upload and asset event.
+const LifecycleStream = "GAMMA_ASSETS"
+
+// Subjects events are published to, below gamma.uploads.> and
+// gamma.assets.>.
+const (
+	UploadCreatedSubject    = "gamma.uploads.created"
+	UploadUploadedSubject   = "gamma.uploads.uploaded"
+	UploadProcessingSubject = "gamma.uploads.processing"
+	UploadProgressSubject   = "gamma.uploads.progress"
+	UploadFailedSubject     = "gamma.uploads.failed"
+	AssetProcessedSubject   = "gamma.assets.processed"
+	AssetDeletedSubject     = "gamma.assets.deleted"
+)
+
+// LifecycleSubjects are the subjects of LifecycleStream.
+var LifecycleSubjects = []string{"gamma.uploads.>", "gamma.assets.>"}
+
+var subjects = map[string]string{
+	TypeUploadCreatedV1:    UploadCreatedSubject,
+	TypeUploadUploadedV1:   UploadUploadedSubject,
+	TypeUploadProcessingV1: UploadProcessingSubject,
+	TypeUploadProgressV1:   UploadProgressSubject,
+	TypeUploadFailedV1:     UploadFailedSubject,
+	TypeAssetProcessedV1:   AssetProcessedSubject,
+	TypeAssetDeletedV1:     AssetDeletedSubject,
+}
+
+// Subject returns the subject events of the given type are published to.
+func Subject(eventType string) string {
+	return subjects[eventType]
+}
+
+// UploadData is the data every upload event carries.
+type UploadData struct {
+	UploadID string `json:"upload_id"`
+	OrgID    string `json:"org_id"`
+	EnvID    string `json:"env_id"`
+	Status   string `json:"status"`
+}
+
+// NewUploadData describes an upload in its current status.
+func NewUploadData(upload db.Upload) UploadData {
+	return UploadData{
+		UploadID: uuid.UUID(upload.ID.Bytes).String(),
+		OrgID:    uuid.UUID(upload.OrgID.Bytes).String(),
+		EnvID:    uuid.UUID(upload.EnvID.Bytes).String(),
+		Status:   string(upload.Status),
+	}
+}
+
+func (d UploadData) EventSubject() string { return d.UploadID }
+
+// UploadCreatedV1 announces an upload waiting for its file.
+type UploadCreatedV1 struct {
+	UploadData
+	Title string `json:"title"`
+}
+
+func (UploadCreatedV1) EventType() string { return TypeUploadCreatedV1 }
+
+// UploadUploadedV1 announces that the file of an upload arrived in storage.
+type UploadUploadedV1 struct {
+	UploadData
+}
+
+func (UploadUploadedV1) EventType() string { return TypeUploadUploadedV1 }
+
+// UploadProcessingV1 announces that a worker started processing an upload.
+type UploadProcessingV1 struct {
+	UploadData
+}
+
+func (UploadProcessingV1) EventType() string { return TypeUploadProcessingV1 }
+
+// UploadProgressV1 reports how much of an upload has been transcoded.
+// Progress events are best effort and may be lost.
+type UploadProgressV1 struct {
+	UploadData
+	Percent int `json:"percent"`
+}
+
+func (UploadProgressV1) EventType() string { return TypeUploadProgressV1 }
+
+// UploadFailedV1 announces an upload whose processing failed.
+type UploadFailedV1 struct {
+	UploadData
+	Error string `json:"error"`
+}
+
+func (UploadFailedV1) EventType() string { return TypeUploadFailedV1 }
+
+// AssetProcessedV1 announces an asset whose renditions are ready.
+type AssetProcessedV1 struct {
+	AssetID  string `json:"asset_id"`
+	UploadID string `json:"upload_id"`
+	OrgID    string `json:"org_id"`
+	EnvID    string `json:"env_id"`
+	Status   string `json:"status"`
+}
+
+func (AssetProcessedV1) EventType() string { return TypeAssetProcessedV1 }
+
+func (e AssetProcessedV1) EventSubject() string { return e.AssetID }
+
+// AssetDeletedV1 announces a deleted asset.
+type AssetDeletedV1 struct {
+	AssetID  string `json:"asset_id"`
+	UploadID string `json:"upload_id"`
+	OrgID    string `json:"org_id"`
+	EnvID    string `json:"env_id"`
+}
+
+func (AssetDeletedV1) EventType() string { return TypeAssetDeletedV1 }
+
+func (e AssetDeletedV1) EventSubject() string { return e.AssetID }
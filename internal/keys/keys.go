@@ -0,0 +1,111 @@
+// Package keys generates content keys for encrypted renditions and seals
+// them with the master key before they are stored.
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ContentKeySize is the size of an AES-128 content key, and of a CENC
+// key ID.
+const ContentKeySize = 16
+
+// Common Encryption schemes of CMAF renditions.
+const (
+	SchemeCENC = "cenc"
+	SchemeCBCS = "cbcs"
+)
+
+// ClearKeySystemID is the DRM system ID of W3C Clear Key.
+const ClearKeySystemID = "e2719d58-a985-b3c9-781a-b030af78d30e"
+
+var ErrNoMasterKey = errors.New("MASTER_KEY is not set")
+
+// NewContentKey returns a random AES-128 key.
+func NewContentKey() ([]byte, error) {
+	key := make([]byte, ContentKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %w", err)
+	}
+	return key, nil
+}
+
+// NewKeyID returns a random CENC key ID.
+func NewKeyID() ([]byte, error) {
+	id := make([]byte, ContentKeySize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return id, nil
+}
+
+// ValidScheme reports whether s is a supported Common Encryption scheme.
+func ValidScheme(s string) bool {
+	return s == SchemeCENC || s == SchemeCBCS
+}
+
+// Seal encrypts a content key with the master key using AES-256-GCM. The
+// nonce is prepended to the result.
+func Seal(key []byte) ([]byte, error) {
+	aead, err := masterAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// Open decrypts a key sealed by Seal.
+func Open(sealed []byte) ([]byte, error) {
+	aead, err := masterAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	key, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sealed key: %w", err)
+	}
+	return key, nil
+}
+
+// CheckMasterKey reports whether MASTER_KEY is set and valid, so services
+// can refuse to start without one.
+func CheckMasterKey() error {
+	_, err := masterAEAD()
+	return err
+}
+
+// masterAEAD reads MASTER_KEY, 32 base64-encoded bytes.
+func masterAEAD() (cipher.AEAD, error) {
+	encoded := os.Getenv("MASTER_KEY")
+	if encoded == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	master, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(master) != 32 {
+		return nil, errors.New("MASTER_KEY must be 32 base64-encoded bytes")
+	}
+
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
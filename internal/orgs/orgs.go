@@ -0,0 +1,185 @@
+// Package orgs exports and purges all data belonging to an organization.
+package orgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/uuid"
+)
+
+// Report lists what an export or purge covered.
+type Report struct {
+	Uploads int
+	Assets  int
+	Objects int
+}
+
+// Export writes the organization, its members, environments, uploads and
+// assets as JSON files to dir and downloads its objects to
+// dir/objects/<key>.
+func Export(ctx context.Context, queries *db.Queries, store *storage.Storage, org db.Organization, dir string) (*Report, error) {
+	uploads, err := queries.ListUploadsByOrg(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	assets, err := queries.ListAssetsByOrg(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assets: %w", err)
+	}
+	members, err := queries.ListOrganizationMembers(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	envs, err := queries.ListEnvironments(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	memberNames := make([]string, 0, len(members))
+	for _, m := range members {
+		memberNames = append(memberNames, m.User.Username)
+	}
+
+	files := map[string]any{
+		"organization.json": org,
+		"members.json":      memberNames,
+		"environments.json": envs,
+		"uploads.json":      uploads,
+		"assets.json":       assets,
+	}
+	for name, v := range files {
+		if err := writeJSON(filepath.Join(dir, name), v); err != nil {
+			return nil, err
+		}
+	}
+
+	prefixes, err := objectPrefixes(uploads, assets, org)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Uploads: len(uploads), Assets: len(assets)}
+	for _, prefix := range prefixes {
+		objects, err := store.ListObjects(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			key := aws.ToString(obj.Key)
+			dest := filepath.Join(dir, "objects", filepath.FromSlash(key))
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory for %s: %w", key, err)
+			}
+			if err := store.DownloadFile(ctx, key, dest); err != nil {
+				return nil, fmt.Errorf("failed to download %s: %w", key, err)
+			}
+			report.Objects++
+		}
+	}
+
+	return report, nil
+}
+
+// Purge deletes the organization's objects and then the organization,
+// which cascades to its members, uploads, assets and API keys. With dryRun
+// it only counts what would be deleted.
+func Purge(ctx context.Context, queries *db.Queries, store *storage.Storage, org db.Organization, dryRun bool) (*Report, error) {
+	uploads, err := queries.ListUploadsByOrg(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	assets, err := queries.ListAssetsByOrg(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assets: %w", err)
+	}
+
+	prefixes, err := objectPrefixes(uploads, assets, org)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Uploads: len(uploads), Assets: len(assets)}
+	for _, prefix := range prefixes {
+		if dryRun {
+			objects, err := store.ListObjects(ctx, prefix)
+			if err != nil {
+				return nil, err
+			}
+			report.Objects += len(objects)
+			continue
+		}
+
+		n, err := store.DeletePrefix(ctx, prefix)
+		report.Objects += n
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := queries.DeleteOrganization(ctx, org.ID); err != nil {
+		return report, fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return report, nil
+}
+
+// objectPrefixes returns the prefixes holding the organization's objects:
+// its namespaces plus the keys of uploads and assets created before
+// objects were namespaced per organization.
+func objectPrefixes(uploads []db.Upload, assets []db.Asset, org db.Organization) ([]string, error) {
+	namespaces := storage.OrgPrefixes(uuid.UUID(org.ID.Bytes).String())
+	prefixes := append([]string{}, namespaces...)
+
+	inNamespace := func(key string) bool {
+		for _, ns := range namespaces {
+			if strings.HasPrefix(key, ns) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, u := range uploads {
+		if !inNamespace(u.S3Key) {
+			prefixes = append(prefixes, u.S3Key)
+		}
+	}
+	for _, a := range assets {
+		// hls_root is "hls/<assetId>/master.m3u8" for legacy assets
+		dir := a.HlsRoot[:strings.LastIndex(a.HlsRoot, "/")+1]
+		if dir == "" {
+			return nil, fmt.Errorf("invalid hls_root %q", a.HlsRoot)
+		}
+		// Deduplicated assets share the renditions of the original
+		if !inNamespace(dir) && !slices.Contains(prefixes, dir) {
+			prefixes = append(prefixes, dir)
+		}
+	}
+	return prefixes, nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package outbox publishes events reliably. Events are written to the
+// outbox table in the transaction that makes the change they describe,
+// and a relay publishes them to NATS once that transaction has committed.
+// An event is thus published at least once if and only if its change is
+// stored, even when NATS is down at the time.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Add records a message for subject. q should be bound to the transaction
+// making the change the message reports on, see db.Queries.WithTx.
+func Add(ctx context.Context, q *db.Queries, subject string, payload []byte) error {
+	err := q.CreateOutboxMessage(ctx, db.CreateOutboxMessageParams{
+		ID:      pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Subject: subject,
+		Payload: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s message to outbox: %w", subject, err)
+	}
+	return nil
+}
+
+// AddEvent records a typed event from source for the subject of its type
+// and for each of also, all with the same envelope.
+func AddEvent(ctx context.Context, q *db.Queries, source string, data events.Payload, also ...string) error {
+	event, err := events.NewCloudEvent(source, data)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	for _, subject := range append([]string{events.Subject(event.Type)}, also...) {
+		if err := Add(ctx, q, subject, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
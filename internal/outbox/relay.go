@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultInterval is how often the relay looks for new messages.
+	DefaultInterval = time.Second
+	// DefaultBatchSize is how many messages a relay claims at once.
+	DefaultBatchSize = 100
+	// DefaultRetention is how long published messages are kept.
+	DefaultRetention = 24 * time.Hour
+)
+
+// Relay publishes outbox messages to the event bus. Several relays may
+// run at once: each claims its batch with FOR UPDATE SKIP LOCKED.
+//
+// A message is marked published only after JetStream acknowledged it, so
+// a crash in between publishes it again. Its ID is sent as Nats-Msg-Id,
+// which lets JetStream drop the duplicate within the stream's duplicate
+// window; consumers must tolerate duplicates beyond that.
+type Relay struct {
+	Pool      *pgxpool.Pool
+	EventBus  *events.EventBus
+	Interval  time.Duration
+	BatchSize int32
+	Retention time.Duration
+}
+
+func NewRelay(pool *pgxpool.Pool, eventBus *events.EventBus) *Relay {
+	return &Relay{
+		Pool:      pool,
+		EventBus:  eventBus,
+		Interval:  DefaultInterval,
+		BatchSize: DefaultBatchSize,
+		Retention: DefaultRetention,
+	}
+}
+
+// Start relays messages until ctx is cancelled.
+func (r *Relay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		// Drain the backlog before waiting for the next tick
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				log.Printf("Outbox relay failed: %v", err)
+				break
+			}
+			if n < int(r.BatchSize) {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			lastCleanup = time.Now()
+			if err := r.cleanup(ctx); err != nil {
+				log.Printf("Outbox cleanup failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes up to BatchSize pending messages, oldest first, and
+// returns how many were published. It stops at the first message NATS
+// rejects, keeping the order of later messages.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	published := 0
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		q := db.New(tx)
+		messages, err := q.ClaimOutboxMessages(ctx, r.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to claim outbox messages: %w", err)
+		}
+
+		for _, msg := range messages {
+			id := uuid.UUID(msg.ID.Bytes).String()
+			if err := r.EventBus.PublishWithID(msg.Subject, msg.Payload, id); err != nil {
+				log.Printf("Failed to publish outbox message %s to %s: %v", id, msg.Subject, err)
+				return q.RecordOutboxFailure(ctx, db.RecordOutboxFailureParams{
+					ID:        msg.ID,
+					LastError: pgtype.Text{String: err.Error(), Valid: true},
+				})
+			}
+			if err := q.MarkOutboxMessagePublished(ctx, msg.ID); err != nil {
+				return fmt.Errorf("failed to mark outbox message %s published: %w", id, err)
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
+
+func (r *Relay) cleanup(ctx context.Context) error {
+	var before pgtype.Timestamptz
+	before.Scan(time.Now().Add(-r.Retention))
+
+	n, err := db.New(r.Pool).DeletePublishedOutboxMessages(ctx, before)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d published outbox messages", n)
+	}
+	return nil
+}
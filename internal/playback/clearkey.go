@@ -0,0 +1,141 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ClearKeyFormat is the EXT-X-KEY KEYFORMAT of Clear Key protected
+// renditions.
+const ClearKeyFormat = "org.w3.clearkey"
+
+var (
+	// templateAttr matches the segment URLs of a DASH SegmentTemplate.
+	templateAttr = regexp.MustCompile(`\b(media|initialization)="([^"]*)"`)
+	// cencProtection matches the ContentProtection element announcing the
+	// Common Encryption scheme and default key ID.
+	cencProtection = regexp.MustCompile(`<ContentProtection[^>]*urn:mpeg:dash:mp4protection:2011[^>]*/>`)
+)
+
+// rewriteManifest prepares a DASH manifest for one player: segment URLs
+// carry the token, and every encrypted adaptation set announces Clear Key
+// with the license URL.
+func rewriteManifest(manifest []byte, token, licenseURL string) []byte {
+	query := "token=" + token
+	manifest = templateAttr.ReplaceAllFunc(manifest, func(attr []byte) []byte {
+		m := templateAttr.FindSubmatch(attr)
+		sep := "?"
+		if bytes.Contains(m[2], []byte("?")) {
+			sep = "&amp;"
+		}
+		return fmt.Appendf(nil, `%s="%s%s%s"`, m[1], m[2], sep, query)
+	})
+
+	laurl := html.EscapeString(licenseURL)
+	clearKey := fmt.Sprintf(
+		`<ContentProtection schemeIdUri="urn:uuid:%s" value="ClearKey1.0">`+
+			`<dashif:Laurl xmlns:dashif="https://dashif.org/CPS">%s</dashif:Laurl>`+
+			`<clearkey:Laurl xmlns:clearkey="http://dashif.org/guidelines/clearKey" Lic_type="EME-1.0">%s</clearkey:Laurl>`+
+			`</ContentProtection>`,
+		keys.ClearKeySystemID, laurl, laurl,
+	)
+	return cencProtection.ReplaceAllFunc(manifest, func(el []byte) []byte {
+		return append(el, clearKey...)
+	})
+}
+
+// LicenseRequest is a W3C Clear Key license request.
+type LicenseRequest struct {
+	KIDs []string `json:"kids"`
+	Type string   `json:"type,omitempty"`
+}
+
+// JWK is a symmetric key in a Clear Key license.
+type JWK struct {
+	Kty string `json:"kty"`
+	KID string `json:"kid"`
+	K   string `json:"k"`
+}
+
+// LicenseResponse is a W3C Clear Key license: a JSON Web Key set.
+type LicenseResponse struct {
+	Keys []JWK  `json:"keys"`
+	Type string `json:"type,omitempty"`
+}
+
+// ServeLicense answers Clear Key license requests for an asset encrypted
+// with Common Encryption. It checks the playback token like ServePlaylist
+// and returns the requested keys, base64url-encoded without padding.
+func (h *Handler) ServeLicense(w http.ResponseWriter, r *http.Request) {
+	assetID := chi.URLParam(r, "assetId")
+
+	if _, err := VerifyToken(r.URL.Query().Get("token"), assetID, r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req LicenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.KIDs) == 0 {
+		http.Error(w, "Invalid license request", http.StatusBadRequest)
+		return
+	}
+
+	var pgUUID pgtype.UUID
+	if err := pgUUID.Scan(assetID); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := h.Queries.ListAssetKeys(r.Context(), pgUUID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load keys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := LicenseResponse{Keys: []JWK{}, Type: req.Type}
+	for _, kid := range req.KIDs {
+		// Some players pad their key IDs
+		id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(kid, "="))
+		if err != nil {
+			http.Error(w, "Invalid key ID", http.StatusBadRequest)
+			return
+		}
+
+		for _, k := range stored {
+			if k.KeyID == nil || !bytes.Equal(k.KeyID, id) {
+				continue
+			}
+			key, err := keys.Open(k.SealedKey)
+			if err != nil {
+				log.Printf("Failed to open content key of asset %s: %v", assetID, err)
+				http.Error(w, "Failed to load key", http.StatusInternalServerError)
+				return
+			}
+			resp.Keys = append(resp.Keys, JWK{
+				Kty: "oct",
+				KID: base64.RawURLEncoding.EncodeToString(id),
+				K:   base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+
+	if len(resp.Keys) == 0 {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,294 @@
+package playback
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// KeyURIPrefix marks the EXT-X-KEY URIs the worker writes. The proxy
+// replaces them with the key endpoint of the asset being played, since
+// renditions shared by several assets cannot name one of them.
+const KeyURIPrefix = "gamma-key:"
+
+// KeyURI returns the placeholder URI of an asset's index-th content key.
+func KeyURI(index int) string {
+	return fmt.Sprintf("%s%d", KeyURIPrefix, index)
+}
+
+// LicenseURIPlaceholder is the EXT-X-KEY URI of CENC renditions, replaced
+// by the Clear Key license endpoint of the asset being played.
+const LicenseURIPlaceholder = "gamma-license:"
+
+// uriAttr matches the URI attribute of tags such as EXT-X-MAP and
+// EXT-X-MEDIA.
+var uriAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+type Handler struct {
+	Storage *storage.Storage
+	// Pool serializes token reservations for an asset in a transaction.
+	Pool    *pgxpool.Pool
+	Queries *db.Queries
+}
+
+func NewHandler(storage *storage.Storage, pool *pgxpool.Pool) *Handler {
+	return &Handler{
+		Storage: storage,
+		Pool:    pool,
+		Queries: db.New(pool),
+	}
+}
+
+// RegisterRoutes registers the playlist proxy. It authenticates with the
+// playback token in ?token= and must not be mounted behind auth.Middleware,
+// since players cannot send the session cookie or CSRF header. Players may
+// be embedded on any origin; referrers are restricted by the token.
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type"},
+		}))
+		r.Get("/playback/{assetId}/*", h.ServePlaylist)
+		r.Get("/keys/{assetId}", h.ServeKey)
+		r.Post("/license/{assetId}", h.ServeLicense)
+	})
+}
+
+// PlaylistPath returns the path of an asset's master playlist on the proxy.
+func PlaylistPath(assetID, hlsRoot, token string) string {
+	return fmt.Sprintf("/playback/%s/%s?token=%s", assetID, path.Base(hlsRoot), url.QueryEscape(token))
+}
+
+// ManifestPath returns the path of the DASH manifest of a CMAF asset on
+// the proxy.
+func ManifestPath(assetID, token string) string {
+	return fmt.Sprintf("/playback/%s/manifest.mpd?token=%s", assetID, url.QueryEscape(token))
+}
+
+// LicensePath returns the path of an asset's Clear Key license endpoint.
+func LicensePath(assetID, token string) string {
+	return fmt.Sprintf("/license/%s?token=%s", assetID, url.QueryEscape(token))
+}
+
+// BaseURL is PUBLIC_API_URL, or the scheme and host the request was made
+// to.
+func BaseURL(r *http.Request) string {
+	if base := os.Getenv("PUBLIC_API_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ServePlaylist returns a playlist of the asset with every URI rewritten:
+// playlists point back at this proxy with the same token, content keys at
+// the key endpoint, and segments and other media at presigned S3 URLs
+// that expire with the token. DASH manifests get the token appended to
+// their segment templates instead, and those segments are redirected to
+// presigned URLs.
+func (h *Handler) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+	assetID := chi.URLParam(r, "assetId")
+	token := r.URL.Query().Get("token")
+
+	claims, err := VerifyToken(token, assetID, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	name := chi.URLParam(r, "*")
+	if name == "" || strings.Contains(name, "..") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	var pgUUID pgtype.UUID
+	if err := pgUUID.Scan(assetID); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	asset, err := h.Queries.GetReadyAsset(r.Context(), pgUUID)
+	if err != nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	// Renditions live next to hls_root: hls/<orgId>/<assetId>/
+	root := path.Dir(asset.HlsRoot)
+	key := path.Join(root, name)
+	expires := time.Until(claims.ExpiresAt.Time)
+
+	if !strings.HasSuffix(name, ".m3u8") && !strings.HasSuffix(name, ".mpd") {
+		signed, err := h.Storage.GeneratePresignedGetURL(r.Context(), key, expires)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to sign segment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, signed, http.StatusFound)
+		return
+	}
+
+	playlist, err := h.Storage.ReadObject(r.Context(), key)
+	if err != nil {
+		log.Printf("Failed to read playlist %s: %v", key, err)
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+
+	licenseURL := BaseURL(r) + LicensePath(assetID, token)
+	if strings.HasSuffix(name, ".mpd") {
+		w.Header().Set("Content-Type", "application/dash+xml")
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Write(rewriteManifest(playlist, token, licenseURL))
+		return
+	}
+	if asset.DrmScheme.Valid {
+		playlist = bytes.ReplaceAll(playlist, []byte(`KEYFORMAT="identity"`), []byte(`KEYFORMAT="`+ClearKeyFormat+`"`))
+	}
+
+	rewritten, err := rewritePlaylist(playlist, func(uri string) (string, error) {
+		if index, ok := strings.CutPrefix(uri, KeyURIPrefix); ok {
+			return fmt.Sprintf("/keys/%s?key=%s&token=%s", assetID, url.QueryEscape(index), url.QueryEscape(token)), nil
+		}
+		if uri == LicenseURIPlaceholder {
+			return licenseURL, nil
+		}
+		if strings.Contains(uri, "://") {
+			return uri, nil
+		}
+
+		rel := path.Join(path.Dir(name), uri)
+		if strings.HasPrefix(rel, "..") {
+			return "", fmt.Errorf("URI %q leaves the asset", uri)
+		}
+		if strings.HasSuffix(rel, ".m3u8") {
+			return fmt.Sprintf("/playback/%s/%s?token=%s", assetID, rel, url.QueryEscape(token)), nil
+		}
+		return h.Storage.GeneratePresignedGetURL(r.Context(), path.Join(root, rel), expires)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to sign playlist: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(rewritten)
+}
+
+// ServeKey returns a content key of an encrypted asset, ?key= selecting
+// the rotation (0 by default). It checks the playback token like
+// ServePlaylist, so keys are only handed to players allowed to play.
+func (h *Handler) ServeKey(w http.ResponseWriter, r *http.Request) {
+	assetID := chi.URLParam(r, "assetId")
+	query := r.URL.Query()
+
+	if _, err := VerifyToken(query.Get("token"), assetID, r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var pgUUID pgtype.UUID
+	if err := pgUUID.Scan(assetID); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	index := 0
+	if v := query.Get("key"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid key", http.StatusBadRequest)
+			return
+		}
+		index = n
+	}
+
+	stored, err := h.Queries.GetAssetKey(r.Context(), db.GetAssetKeyParams{
+		AssetID:  pgUUID,
+		KeyIndex: int32(index),
+	})
+	if err != nil {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	key, err := keys.Open(stored.SealedKey)
+	if err != nil {
+		log.Printf("Failed to open content key %d of asset %s: %v", index, assetID, err)
+		http.Error(w, "Failed to load key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(key)
+}
+
+// rewritePlaylist replaces every URI in an m3u8 playlist, both URI lines
+// and URI="..." attributes, with the result of rewrite.
+func rewritePlaylist(playlist []byte, rewrite func(uri string) (string, error)) ([]byte, error) {
+	var out bytes.Buffer
+	var rewriteErr error
+
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			line = uriAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := uriAttr.FindStringSubmatch(attr)[1]
+				signed, err := rewrite(uri)
+				if err != nil {
+					rewriteErr = errors.Join(rewriteErr, err)
+					return attr
+				}
+				return `URI="` + signed + `"`
+			})
+		default:
+			signed, err := rewrite(line)
+			if err != nil {
+				return nil, err
+			}
+			line = signed
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if rewriteErr != nil {
+		return nil, rewriteErr
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,220 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrReferrerRequired   = errors.New("this asset can only be played from allowed referrers")
+	ErrReferrerNotAllowed = errors.New("referrer is not allowed to play this asset")
+	ErrTooManyTokens      = errors.New("too many active playback tokens for this asset")
+)
+
+// Grant is how a client may play an asset: a plain URL for public assets,
+// or a proxied URL with a token otherwise.
+type Grant struct {
+	// Path is the playlist path on the playback proxy, "" for public
+	// assets, which are played straight from the bucket at URL.
+	Path string
+	// DashPath and LicensePath are set for CMAF assets encrypted with
+	// Common Encryption.
+	DashPath    string
+	LicensePath string
+	URL         string
+	Token       string
+	ExpiresAt   time.Time
+}
+
+// Request describes who asks to play an asset.
+type Request struct {
+	TokenOptions
+	// ClientIP is the caller's address. Private assets are bound to it
+	// unless TokenOptions.IP names another one.
+	ClientIP string
+	// RefererOrigin is the origin of the page the caller is on, used
+	// when TokenOptions.Referrer is empty.
+	RefererOrigin string
+}
+
+// Grant applies the asset's visibility and playback policy:
+//   - public assets get their unsigned bucket URL, unless they are
+//     encrypted, since their keys are only served with a token, or share
+//     renditions with an asset that is not public,
+//   - unlisted assets get a signed URL anyone holding it can use,
+//   - private assets get a signed URL bound to the client's IP.
+//
+// For signed URLs the policy may require an allowed referrer, shortens the
+// token's lifetime and caps how many unexpired tokens exist.
+func (h *Handler) Grant(ctx context.Context, asset db.Asset, req Request) (*Grant, error) {
+	if asset.Visibility == db.AssetVisibilityPublic && !asset.Encrypted {
+		// Renditions shared with a twin that is not public stay private
+		public, err := h.Queries.IsHlsRootPublic(ctx, asset.HlsRoot)
+		if err != nil {
+			return nil, err
+		}
+		if public {
+			u, err := h.Storage.PublicURL(ctx, asset.HlsRoot)
+			if err != nil {
+				return nil, err
+			}
+			return &Grant{URL: u}, nil
+		}
+	}
+
+	opts := req.TokenOptions
+	if len(asset.AllowedReferrers) > 0 {
+		if opts.Referrer == "" {
+			opts.Referrer = req.RefererOrigin
+		}
+		if opts.Referrer == "" {
+			return nil, ErrReferrerRequired
+		}
+		if !referrerAllowed(opts.Referrer, asset.AllowedReferrers) {
+			return nil, ErrReferrerNotAllowed
+		}
+	}
+
+	if asset.TokenTtlSeconds > 0 {
+		opts.TTL = min(effectiveTTL(opts.TTL), time.Duration(asset.TokenTtlSeconds)*time.Second)
+	}
+	if asset.Visibility == db.AssetVisibilityPrivate && opts.IP == "" {
+		opts.IP = req.ClientIP
+	}
+
+	id := uuid.New()
+	opts.ID = id.String()
+
+	if asset.MaxTokens > 0 {
+		if err := h.reserveToken(ctx, asset, id, opts.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	assetID := uuid.UUID(asset.ID.Bytes).String()
+	token, expiresAt, err := IssueToken(assetID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &Grant{
+		Path:      PlaylistPath(assetID, asset.HlsRoot, token),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}
+	if asset.DrmScheme.Valid {
+		grant.DashPath = ManifestPath(assetID, token)
+		grant.LicensePath = LicensePath(assetID, token)
+	}
+	return grant, nil
+}
+
+// reserveToken records a token against the asset's max_tokens, failing
+// with ErrTooManyTokens when the limit is reached. Reservations for the
+// same asset are serialized by locking its row, so concurrent requests
+// cannot both see the last free slot.
+func (h *Handler) reserveToken(ctx context.Context, asset db.Asset, id uuid.UUID, ttl time.Duration) error {
+	var pgID pgtype.UUID
+	pgID.Scan(id.String())
+
+	var n int64
+	err := pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		if err := q.LockAssetForPlaybackTokens(ctx, asset.ID); err != nil {
+			return fmt.Errorf("failed to lock asset: %w", err)
+		}
+		if err := q.DeleteExpiredPlaybackTokens(ctx, asset.ID); err != nil {
+			return fmt.Errorf("failed to expire playback tokens: %w", err)
+		}
+
+		var err error
+		n, err = q.CreatePlaybackToken(ctx, db.CreatePlaybackTokenParams{
+			ID:        pgID,
+			AssetID:   asset.ID,
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(effectiveTTL(ttl)), Valid: true},
+			MaxTokens: asset.MaxTokens,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record playback token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTooManyTokens
+	}
+	return nil
+}
+
+// SyncBucketPolicy makes the renditions of public, ready assets
+// world-readable and everything else private. Renditions shared by
+// deduplicated assets are only made readable when every one of them is
+// public. It derives the policy from the database, so it can run on any
+// instance at any time.
+func (h *Handler) SyncBucketPolicy(ctx context.Context) error {
+	roots, err := h.Queries.ListPublicAssetRoots(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list public assets: %w", err)
+	}
+
+	var prefixes []string
+	for _, root := range roots {
+		// Deduplicated assets share their renditions
+		prefix := path.Dir(root) + "/"
+		if !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return h.Storage.SetPublicPrefixes(ctx, prefixes)
+}
+
+// ValidReferrerDomain reports whether d is a host name, optionally with a
+// leading "*." matching its subdomains.
+func ValidReferrerDomain(d string) bool {
+	d = strings.TrimPrefix(d, "*.")
+	if d == "" || strings.ContainsAny(d, "/:*") || d != strings.ToLower(d) {
+		return false
+	}
+	return !strings.HasPrefix(d, ".") && !strings.HasSuffix(d, ".")
+}
+
+// referrerAllowed reports whether the host of origin matches one of the
+// allowed domains.
+func referrerAllowed(origin string, domains []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, d := range domains {
+		if suffix, ok := strings.CutPrefix(d, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == d {
+			return true
+		}
+	}
+	return false
+}
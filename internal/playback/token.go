@@ -0,0 +1,131 @@
+// Package playback issues playback tokens and serves HLS playlists whose
+// segment URLs are signed, so renditions never have to be public.
+package playback
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/tools"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultTokenTTL is how long a playback token is valid unless the
+	// client asks for less.
+	DefaultTokenTTL = 1 * time.Hour
+	// MaxTokenTTL caps the lifetime of a playback token. Presigned S3 URLs
+	// cannot be valid for longer than a week either.
+	MaxTokenTTL = 24 * time.Hour
+
+	// audience keeps session tokens, which may share the signing key, from
+	// being accepted as playback tokens and vice versa.
+	audience = "gamma-playback"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid playback token")
+	ErrIPMismatch      = errors.New("playback token is bound to another IP address")
+	ErrRefererMismatch = errors.New("playback token is bound to another referrer")
+)
+
+// Claims are the payload of a playback token. RegisteredClaims.Subject
+// holds the asset ID.
+type Claims struct {
+	// IP, when set, is the only client address the token is valid for.
+	IP string `json:"ip,omitempty"`
+	// Referrer, when set, is the origin the player must be embedded on.
+	Referrer string `json:"ref,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenOptions restrict a playback token.
+type TokenOptions struct {
+	// ID becomes the token's jti, used to count tokens against a policy.
+	ID       string
+	TTL      time.Duration
+	IP       string
+	Referrer string
+}
+
+// IssueToken returns a playback token for assetID and its expiry.
+func IssueToken(assetID string, opts TokenOptions) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(effectiveTTL(opts.TTL))
+	claims := &Claims{
+		IP:       opts.IP,
+		Referrer: opts.Referrer,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        opts.ID,
+			Subject:   assetID,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// effectiveTTL applies the default and the maximum to a requested TTL.
+func effectiveTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return min(ttl, MaxTokenTTL)
+}
+
+// VerifyToken checks that token is valid for assetID and for the client
+// making r.
+func VerifyToken(token, assetID string, r *http.Request) (*Claims, error) {
+	claims := &Claims{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return signingKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithAudience(audience))
+	if err != nil || !tkn.Valid || claims.Subject != assetID {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.IP != "" && claims.IP != ClientIP(r) {
+		return nil, ErrIPMismatch
+	}
+	if claims.Referrer != "" && claims.Referrer != RefererOrigin(r) {
+		return nil, ErrRefererMismatch
+	}
+	return claims, nil
+}
+
+// RefererOrigin returns the scheme and host of the request's Referer
+// header, or "" when there is none.
+func RefererOrigin(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// signingKey is PLAYBACK_SECRET, falling back to SESSION_SECRET so
+// existing deployments need no new configuration.
+func signingKey() []byte {
+	if secret := os.Getenv("PLAYBACK_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(tools.GetEnv("SESSION_SECRET"))
+}
@@ -0,0 +1,287 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
+	"github.com/OZIOisgood/gamma/internal/worker"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultGracePeriod is how long an original object may exist without
+	// being picked up before it is considered missed. It covers the delay
+	// between the upload finishing and the MinIO notification arriving.
+	DefaultGracePeriod = 5 * time.Minute
+
+	// DefaultStuckAfter is how long an upload may stay in "processing"
+	// before its worker is assumed dead.
+	DefaultStuckAfter = 1 * time.Hour
+)
+
+// Reconciler compares the objects in S3 with the uploads and assets in
+// Postgres and repairs what the event pipeline missed.
+type Reconciler struct {
+	Pool        *pgxpool.Pool
+	Queries     *db.Queries
+	Storage     *storage.Storage
+	EventBus    *events.EventBus
+	GracePeriod time.Duration
+	StuckAfter  time.Duration
+	// DryRun reports problems without re-enqueueing jobs or updating rows.
+	DryRun bool
+}
+
+// Report lists what a single reconciliation pass found.
+type Report struct {
+	// Requeued holds original keys of unprocessed uploads that were re-enqueued.
+	Requeued []string
+	// Stuck holds keys of uploads flagged as failed after stalling in processing.
+	Stuck []string
+	// OrphanedOriginals holds original keys without an upload record.
+	OrphanedOriginals []string
+	// OrphanedHLS holds HLS prefixes without an asset record.
+	OrphanedHLS []string
+	// MissingAssets holds keys of ready uploads that have no asset.
+	MissingAssets []string
+}
+
+func NewReconciler(pool *pgxpool.Pool, storage *storage.Storage, eventBus *events.EventBus) *Reconciler {
+	return &Reconciler{
+		Pool:        pool,
+		Queries:     db.New(pool),
+		Storage:     storage,
+		EventBus:    eventBus,
+		GracePeriod: DefaultGracePeriod,
+		StuckAfter:  DefaultStuckAfter,
+	}
+}
+
+// Run performs a single reconciliation pass.
+func (r *Reconciler) Run(ctx context.Context) (*Report, error) {
+	report := &Report{}
+
+	if err := r.reconcileOriginals(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := r.reconcileStuck(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := r.reconcileHLS(ctx, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Start runs a reconciliation pass every interval until ctx is cancelled.
+func (r *Reconciler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.Run(ctx)
+			if err != nil {
+				log.Printf("Reconciliation failed: %v", err)
+				continue
+			}
+			report.Log()
+		}
+	}
+}
+
+func (r *Reconciler) reconcileOriginals(ctx context.Context, report *Report) error {
+	objects, err := r.Storage.ListObjects(ctx, "original/")
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+
+		upload, err := r.Queries.GetUploadByKey(ctx, key)
+		if err == pgx.ErrNoRows {
+			report.OrphanedOriginals = append(report.OrphanedOriginals, key)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get upload for %s: %w", key, err)
+		}
+
+		switch upload.Status {
+		case db.UploadStatusPending, db.UploadStatusUploaded:
+			// Give the notification, or an earlier re-enqueue, a chance to
+			// be picked up before re-enqueueing.
+			if obj.LastModified != nil && time.Since(*obj.LastModified) < r.GracePeriod {
+				continue
+			}
+			if upload.EnqueuedAt.Valid && time.Since(upload.EnqueuedAt.Time) < r.GracePeriod {
+				continue
+			}
+			_, err := r.Queries.GetAssetByUploadID(ctx, db.GetAssetByUploadIDParams{
+				UploadID: upload.ID,
+				OrgID:    upload.OrgID,
+				EnvID:    upload.EnvID,
+			})
+			if err == nil {
+				continue
+			}
+			if err != pgx.ErrNoRows {
+				return fmt.Errorf("failed to get asset for %s: %w", key, err)
+			}
+			if !r.DryRun {
+				if err := r.requeue(key); err != nil {
+					return err
+				}
+				if err := r.Queries.MarkUploadEnqueued(ctx, upload.ID); err != nil {
+					return fmt.Errorf("failed to mark %s as enqueued: %w", key, err)
+				}
+			}
+			report.Requeued = append(report.Requeued, key)
+		case db.UploadStatusReady:
+			_, err := r.Queries.GetAssetByUploadID(ctx, db.GetAssetByUploadIDParams{
+				UploadID: upload.ID,
+				OrgID:    upload.OrgID,
+				EnvID:    upload.EnvID,
+			})
+			if err == pgx.ErrNoRows {
+				report.MissingAssets = append(report.MissingAssets, key)
+			} else if err != nil {
+				return fmt.Errorf("failed to get asset for %s: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Reconciler) reconcileStuck(ctx context.Context, report *Report) error {
+	var before pgtype.Timestamptz
+	before.Scan(time.Now().Add(-r.StuckAfter))
+
+	uploads, err := r.Queries.ListStuckUploads(ctx, before)
+	if err != nil {
+		return fmt.Errorf("failed to list stuck uploads: %w", err)
+	}
+
+	for _, upload := range uploads {
+		if !r.DryRun {
+			err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+				q := r.Queries.WithTx(tx)
+				failed, err := q.UpdateUploadStatusByKey(ctx, db.UpdateUploadStatusByKeyParams{
+					S3Key:  upload.S3Key,
+					Status: db.UploadStatusFailed,
+				})
+				if err != nil {
+					return err
+				}
+				return webhooks.Record(ctx, q, events.SourceReconciler, events.UploadFailedV1{
+					UploadData: events.NewUploadData(failed),
+					Error:      "processing timed out",
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to flag stuck upload %s: %w", upload.S3Key, err)
+			}
+		}
+		report.Stuck = append(report.Stuck, upload.S3Key)
+	}
+
+	return nil
+}
+
+func (r *Reconciler) reconcileHLS(ctx context.Context, report *Report) error {
+	prefixes, err := r.Storage.ListPrefixes(ctx, "hls/")
+	if err != nil {
+		return err
+	}
+
+	orgs, err := r.Queries.ListOrganizations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	// Renditions live below hls/<orgId>/, except for assets created before
+	// organizations existed, which sit directly below hls/.
+	for _, org := range orgs {
+		orgPrefix := storage.HLSPrefix(uuid.UUID(org.ID.Bytes).String())
+		if !slices.Contains(prefixes, orgPrefix) {
+			continue
+		}
+		prefixes = slices.DeleteFunc(prefixes, func(p string) bool { return p == orgPrefix })
+
+		assetPrefixes, err := r.Storage.ListPrefixes(ctx, orgPrefix)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, assetPrefixes...)
+	}
+
+	assets, err := r.Queries.ListAssets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list assets: %w", err)
+	}
+
+	known := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		// hls_root is "hls/<orgId>/<assetId>/master.m3u8"
+		known[asset.HlsRoot[:strings.LastIndex(asset.HlsRoot, "/")+1]] = true
+	}
+
+	for _, prefix := range prefixes {
+		if !known[prefix] {
+			report.OrphanedHLS = append(report.OrphanedHLS, prefix)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reconciler) requeue(key string) error {
+	data, err := worker.NewUploadEvent(r.Storage.Bucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to build upload event for %s: %w", key, err)
+	}
+	if err := r.EventBus.Publish(worker.UploadEventSubject, data); err != nil {
+		return fmt.Errorf("failed to re-enqueue %s: %w", key, err)
+	}
+	return nil
+}
+
+// Log writes a summary of the report, listing every finding.
+func (rep *Report) Log() {
+	log.Printf("Reconciliation: %d requeued, %d stuck, %d orphaned originals, %d orphaned HLS prefixes, %d missing assets",
+		len(rep.Requeued), len(rep.Stuck), len(rep.OrphanedOriginals), len(rep.OrphanedHLS), len(rep.MissingAssets))
+
+	for _, key := range rep.Requeued {
+		log.Printf("  requeued: %s", key)
+	}
+	for _, key := range rep.Stuck {
+		log.Printf("  stuck in processing: %s", key)
+	}
+	for _, key := range rep.OrphanedOriginals {
+		log.Printf("  orphaned original: %s", key)
+	}
+	for _, prefix := range rep.OrphanedHLS {
+		log.Printf("  orphaned HLS prefix: %s", prefix)
+	}
+	for _, key := range rep.MissingAssets {
+		log.Printf("  ready without asset: %s", key)
+	}
+}
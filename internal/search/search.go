@@ -0,0 +1,108 @@
+package search
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Index finds assets matching a free-text query. The API depends only on
+// this interface so an external engine can replace the Postgres one.
+type Index interface {
+	Search(ctx context.Context, q Query) ([]Result, error)
+}
+
+type Query struct {
+	// OrgID and EnvID limit the results to one environment's assets.
+	OrgID pgtype.UUID
+	EnvID pgtype.UUID
+	// Text is the user input. Every word is matched as a prefix.
+	Text   string
+	Limit  int32
+	Offset int32
+}
+
+type Result struct {
+	Asset db.Asset `json:"asset"`
+	Rank  float32  `json:"rank"`
+	// TitleHighlight is the title with matches wrapped in <mark> tags.
+	// It is safe HTML: everything else is escaped.
+	TitleHighlight string `json:"title_highlight"`
+	// Snippet holds fragments of the description and transcript around
+	// the matches, wrapped in <mark> tags. Like TitleHighlight it is
+	// safe HTML.
+	Snippet string `json:"snippet"`
+}
+
+// Postgres searches the asset_search table, which a trigger keeps in sync
+// with the title, tags, description and transcript of each asset.
+type Postgres struct {
+	Queries *db.Queries
+}
+
+func NewPostgres(queries *db.Queries) *Postgres {
+	return &Postgres{Queries: queries}
+}
+
+func (p *Postgres) Search(ctx context.Context, q Query) ([]Result, error) {
+	tsquery := prefixQuery(q.Text)
+	if tsquery == "" {
+		return []Result{}, nil
+	}
+
+	rows, err := p.Queries.SearchAssets(ctx, db.SearchAssetsParams{
+		Query:  tsquery,
+		OrgID:  q.OrgID,
+		EnvID:  q.EnvID,
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, Result{
+			Asset:          row.Asset,
+			Rank:           row.Rank,
+			TitleHighlight: highlight(row.TitleHighlight),
+			Snippet:        highlight(row.Snippet),
+		})
+	}
+	return results, nil
+}
+
+// SearchAssets marks matches with these private use characters, which it
+// strips from the text first, so user input cannot forge a highlight.
+const (
+	startSel = "\ue000"
+	stopSel  = "\ue001"
+)
+
+var marks = strings.NewReplacer(startSel, "<mark>", stopSel, "</mark>")
+
+// highlight HTML-escapes a headline and then turns its match markers into
+// <mark> tags, so titles and descriptions cannot inject markup.
+func highlight(headline string) string {
+	return marks.Replace(html.EscapeString(headline))
+}
+
+// prefixQuery turns free text into a tsquery that requires every word to
+// match as a prefix, e.g. "big buck" becomes "big:* & buck:*". Anything but
+// letters and digits is dropped so user input cannot inject tsquery syntax.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, w+":*")
+	}
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,50 @@
+package search
+
+import "testing"
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"only punctuation", " &|!():* ", ""},
+		{"single word", "Big", "big:*"},
+		{"several words", "big buck bunny", "big:* & buck:* & bunny:*"},
+		{"extra whitespace", "  big \t buck\n", "big:* & buck:*"},
+		{"digits", "episode 42", "episode:* & 42:*"},
+		{"tsquery operators", "big & !buck | (bunny)", "big:* & buck:* & bunny:*"},
+		{"prefix syntax", "big:* buck:A", "big:* & buck:* & a:*"},
+		{"quotes", `it's "bunny"`, "it:* & s:* & bunny:*"},
+		{"unicode letters", "Café Müller", "café:* & müller:*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixQuery(tt.text); got != tt.want {
+				t.Errorf("prefixQuery(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{"no match", "Big Buck Bunny", "Big Buck Bunny"},
+		{"match", startSel + "Big" + stopSel + " Buck", "<mark>Big</mark> Buck"},
+		{"markup is escaped", `<img src=x onerror="alert(1)">`, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;"},
+		{"literal mark tags are escaped", "<mark>Big</mark>", "&lt;mark&gt;Big&lt;/mark&gt;"},
+		{"match inside markup", "<b>" + startSel + "Big" + stopSel + "</b>", "&lt;b&gt;<mark>Big</mark>&lt;/b&gt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.headline); got != tt.want {
+				t.Errorf("highlight(%q) = %q, want %q", tt.headline, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package storage
+
+import "fmt"
+
+// Objects are namespaced per organization so a tenant's data can be
+// exported or purged by prefix. Uploads created before organizations
+// existed keep their original un-namespaced keys.
+
+// OriginalKey returns the key an upload's source file is stored at:
+// original/<orgId>/<uploadId><ext>.
+func OriginalKey(orgID, uploadID, ext string) string {
+	return fmt.Sprintf("original/%s/%s%s", orgID, uploadID, ext)
+}
+
+// HLSPrefix returns the prefix below which an organization's renditions
+// are stored, one "directory" per asset: hls/<orgId>/<assetId>/.
+func HLSPrefix(orgID string) string {
+	return fmt.Sprintf("hls/%s/", orgID)
+}
+
+// OrgPrefixes returns every prefix holding objects of an organization.
+func OrgPrefixes(orgID string) []string {
+	return []string{
+		fmt.Sprintf("original/%s/", orgID),
+		HLSPrefix(orgID),
+	}
+}
@@ -2,10 +2,14 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/OZIOisgood/gamma/internal/tools"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -130,24 +134,43 @@ func (s *Storage) EnsureBucketNotification(ctx context.Context) error {
 	return nil
 }
 
-func (s *Storage) EnsureHLSPublicPolicy(ctx context.Context) error {
-	policy := fmt.Sprintf(`{
+// SetPublicPrefixes replaces the bucket policy so that objects below the
+// given prefixes are world-readable and everything else needs a presigned
+// URL. With no prefixes the policy is removed.
+func (s *Storage) SetPublicPrefixes(ctx context.Context, prefixes []string) error {
+	if len(prefixes) == 0 {
+		_, err := s.Client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(s.Bucket),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket policy: %w", err)
+		}
+		return nil
+	}
+
+	resources := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		resources = append(resources, fmt.Sprintf("arn:aws:s3:::%s/%s*", s.Bucket, prefix))
+	}
+
+	policy, err := json.Marshal(map[string]any{
 		"Version": "2012-10-17",
-		"Statement": [
+		"Statement": []map[string]any{
 			{
-				"Effect": "Allow",
-				"Principal": {
-					"AWS": ["*"]
-				},
-				"Action": ["s3:GetObject"],
-				"Resource": ["arn:aws:s3:::%s/hls/*"]
-			}
-		]
-	}`, s.Bucket)
+				"Effect":    "Allow",
+				"Principal": map[string]any{"AWS": []string{"*"}},
+				"Action":    []string{"s3:GetObject"},
+				"Resource":  resources,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode bucket policy: %w", err)
+	}
 
-	_, err := s.Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+	_, err = s.Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
 		Bucket: aws.String(s.Bucket),
-		Policy: aws.String(policy),
+		Policy: aws.String(string(policy)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to set bucket policy: %w", err)
@@ -166,11 +189,11 @@ func (s *Storage) GeneratePresignedPutURL(ctx context.Context, key string) (stri
 	return req.URL, nil
 }
 
-func (s *Storage) GeneratePresignedGetURL(ctx context.Context, key string) (string, error) {
+func (s *Storage) GeneratePresignedGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
 	req, err := s.PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(key),
-	})
+	}, s3.WithPresignExpires(expires))
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -204,6 +227,36 @@ func (s *Storage) DownloadFile(ctx context.Context, key string, destPath string)
 	return nil
 }
 
+// PublicURL returns the unsigned URL of key, which only works for objects
+// made public by SetPublicPrefixes.
+func (s *Storage) PublicURL(ctx context.Context, key string) (string, error) {
+	presigned, err := s.GeneratePresignedGetURL(ctx, key, time.Minute)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(presigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// ReadObject returns the content of a small object such as a playlist.
+func (s *Storage) ReadObject(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
 func (s *Storage) UploadFile(ctx context.Context, key string, srcPath string, contentType string) error {
 	file, err := os.Open(srcPath)
 	if err != nil {
@@ -223,3 +276,101 @@ func (s *Storage) UploadFile(ctx context.Context, key string, srcPath string, co
 
 	return nil
 }
+
+func (s *Storage) ListObjects(ctx context.Context, prefix string) ([]types.Object, error) {
+	var objects []types.Object
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+
+	return objects, nil
+}
+
+// ListPrefixes returns the immediate "directories" below prefix,
+// e.g. "hls/<assetId>/" for prefix "hls/".
+func (s *Storage) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var prefixes []string
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list prefixes: %w", err)
+		}
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(p.Prefix))
+		}
+	}
+
+	return prefixes, nil
+}
+
+// DeletePrefix deletes every object below prefix and returns how many were
+// removed.
+func (s *Storage) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	objects, err := s.ListObjects(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	// DeleteObjects accepts at most 1000 keys per request
+	deleted := 0
+	for start := 0; start < len(objects); start += 1000 {
+		end := min(start+1000, len(objects))
+
+		ids := make([]types.ObjectIdentifier, 0, end-start)
+		for _, obj := range objects[start:end] {
+			ids = append(ids, types.ObjectIdentifier{Key: obj.Key})
+		}
+
+		_, err := s.Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.Bucket),
+			Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete objects: %w", err)
+		}
+		deleted += len(ids)
+	}
+
+	return deleted, nil
+}
+
+// CopyPrefix copies every object below src to the same relative key below
+// dst within the bucket and returns how many were copied. The copy happens
+// server-side, nothing is downloaded.
+func (s *Storage) CopyPrefix(ctx context.Context, src, dst string) (int, error) {
+	objects, err := s.ListObjects(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		_, err := s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(s.Bucket),
+			CopySource: aws.String(url.PathEscape(s.Bucket + "/" + key)),
+			Key:        aws.String(dst + strings.TrimPrefix(key, src)),
+		})
+		if err != nil {
+			return copied, fmt.Errorf("failed to copy %s: %w", key, err)
+		}
+		copied++
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,81 @@
+package uploads
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DeleteAsset deletes an asset and, unless deduplicated assets still play
+// them, its renditions. Promoted copies have renditions of their own and
+// are not affected. The upload and its original file are kept.
+func (h *Handler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var pgUUID pgtype.UUID
+	if err := pgUUID.Scan(idStr); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var asset db.Asset
+	err := pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		var err error
+		asset, err = q.DeleteAsset(ctx, db.DeleteAssetParams{
+			ID:    pgUUID,
+			OrgID: auth.OrgID(ctx),
+			EnvID: auth.EnvID(ctx),
+		})
+		if err != nil {
+			return err
+		}
+		return webhooks.Record(ctx, q, events.SourceAPI, events.AssetDeletedV1{
+			AssetID:  idStr,
+			UploadID: uuid.UUID(asset.UploadID.Bytes).String(),
+			OrgID:    uuid.UUID(asset.OrgID.Bytes).String(),
+			EnvID:    uuid.UUID(asset.EnvID.Bytes).String(),
+		})
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete asset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	shared, err := h.Queries.CountAssetsByHlsRoot(ctx, asset.HlsRoot)
+	if err != nil {
+		log.Printf("Failed to check renditions of deleted asset %s: %v", idStr, err)
+	} else if shared == 0 {
+		// Renditions live next to hls_root: hls/<orgId>/<assetId>/
+		prefix := path.Dir(asset.HlsRoot) + "/"
+		if _, err := h.Storage.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Failed to delete renditions %s: %v", prefix, err)
+		}
+	}
+
+	// Deleting a twin that is not public may leave only public assets on
+	// shared renditions
+	if asset.Visibility == db.AssetVisibilityPublic || shared > 0 {
+		if err := h.Playback.SyncBucketPolicy(ctx); err != nil {
+			log.Printf("Failed to sync bucket policy: %v", err)
+		}
+	}
+
+	auth.Audit(ctx, h.Queries, "asset.delete", "asset", idStr)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,58 +1,281 @@
 package uploads
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/OZIOisgood/gamma/internal/auth"
 	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/OZIOisgood/gamma/internal/playback"
+	"github.com/OZIOisgood/gamma/internal/search"
 	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Handler struct {
 	Storage *storage.Storage
-	Queries *db.Queries
+	// Pool runs the changes that record events, which must commit together.
+	Pool     *pgxpool.Pool
+	Queries  *db.Queries
+	Search   search.Index
+	Playback *playback.Handler
 }
 
-func NewHandler(storage *storage.Storage, queries *db.Queries) *Handler {
+func NewHandler(storage *storage.Storage, pool *pgxpool.Pool, index search.Index, player *playback.Handler) *Handler {
 	return &Handler{
-		Storage: storage,
-		Queries: queries,
+		Storage:  storage,
+		Pool:     pool,
+		Queries:  db.New(pool),
+		Search:   index,
+		Playback: player,
 	}
 }
 
+// RegisterRoutes registers the upload and asset routes, each guarded by the
+// permission it needs. They must be mounted behind auth.Middleware. Every
+// route is also available below /env/{env}; without that prefix the
+// environment comes from the X-Gamma-Environment header.
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Post("/uploads", h.CreateUpload)
-	r.Get("/uploads", h.List)
-	r.Get("/uploads/{id}", h.Get)
-	r.Get("/assets", h.ListAssets)
-	r.Get("/assets/{id}", h.GetAsset)
-	r.Get("/assets/{id}/playlist", h.GetAssetPlaylist)
+	r.Group(h.routes)
+	r.Route("/env/{env}", h.routes)
+}
+
+func (h *Handler) routes(r chi.Router) {
+	r.Use(auth.RequireOrg, auth.SelectEnvironment(h.Queries))
+
+	canUpload := auth.Require(auth.PermUploadsCreate)
+	canReadUploads := auth.Require(auth.PermUploadsRead)
+	canReadAssets := auth.Require(auth.PermAssetsRead)
+	canWriteAssets := auth.Require(auth.PermAssetsWrite)
+
+	r.With(canUpload).Post("/uploads", h.CreateUpload)
+	r.With(canReadUploads).Get("/uploads", h.List)
+	r.With(canReadUploads).Get("/uploads/{id}", h.Get)
+	r.With(canReadAssets).Get("/assets", h.ListAssets)
+	r.With(canReadAssets).Get("/assets/search", h.SearchAssets)
+	r.With(canReadAssets).Get("/assets/{id}", h.GetAsset)
+	r.With(canWriteAssets).Patch("/assets/{id}", h.UpdateAsset)
+	r.With(canWriteAssets).Delete("/assets/{id}", h.DeleteAsset)
+	r.With(canReadAssets).Get("/assets/{id}/playlist", h.GetAssetPlaylist)
+	r.With(auth.Require(auth.PermAssetsPromote)).Post("/assets/{id}/promote", h.PromoteAsset)
 }
 
 func (h *Handler) ListAssets(w http.ResponseWriter, r *http.Request) {
-	assets, err := h.Queries.ListAssets(r.Context())
+	query := r.URL.Query()
+
+	if externalID := query.Get("external_id"); externalID != "" {
+		asset, err := h.Queries.GetAssetByExternalID(r.Context(), db.GetAssetByExternalIDParams{
+			OrgID:      auth.OrgID(r.Context()),
+			EnvID:      auth.EnvID(r.Context()),
+			ExternalID: pgtype.Text{String: externalID, Valid: true},
+		})
+		if err != nil && err != pgx.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Failed to get asset: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		assets := []db.Asset{}
+		if err == nil {
+			assets = append(assets, asset)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assets)
+		return
+	}
+
+	params, err := parseListParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := db.NullAssetStatus{AssetStatus: db.AssetStatus(params.Status), Valid: params.Status != ""}
+	if status.Valid && !validAssetStatus(status.AssetStatus) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	filter, keys, err := metadataFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter == nil {
+		filter = json.RawMessage("{}")
+	}
+
+	ctx := r.Context()
+	assets, err := h.Queries.ListAssetsPage(ctx, db.ListAssetsPageParams{
+		OrgID:         auth.OrgID(ctx),
+		EnvID:         auth.EnvID(ctx),
+		Status:        status,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		CreatorID:     params.CreatorID,
+		Tag:           params.Tag,
+		Metadata:      filter,
+		Keys:          keys,
+		CursorTime:    params.CursorTime,
+		CursorID:      params.CursorID,
+		SortBy:        params.SortBy,
+		SortDesc:      params.SortDesc,
+		Limit:         params.Limit,
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to list assets: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	total, err := h.Queries.CountAssets(ctx, db.CountAssetsParams{
+		OrgID:         auth.OrgID(ctx),
+		EnvID:         auth.EnvID(ctx),
+		Status:        status,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		CreatorID:     params.CreatorID,
+		Tag:           params.Tag,
+		Metadata:      filter,
+		Keys:          keys,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count assets: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	next := ""
+	if len(assets) > 0 {
+		last := assets[len(assets)-1]
+		next = params.nextCursor(len(assets), last.CreatedAt, last.UpdatedAt, last.ID)
+	}
+	writePageHeaders(w, r, total, next)
+
+	if assets == nil {
+		assets = []db.Asset{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(assets)
 }
 
+func (h *Handler) SearchAssets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := query.Get("q")
+	if q == "" {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := int32(20)
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = int32(min(n, 100))
+	}
+
+	offset := int32(0)
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = int32(n)
+	}
+
+	results, err := h.Search.Search(r.Context(), search.Query{
+		OrgID:  auth.OrgID(r.Context()),
+		EnvID:  auth.EnvID(r.Context()),
+		Text:   q,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to search assets: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	videos, err := h.Queries.ListUploads(r.Context())
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := db.NullUploadStatus{UploadStatus: db.UploadStatus(params.Status), Valid: params.Status != ""}
+	if status.Valid && !validUploadStatus(status.UploadStatus) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	videos, err := h.Queries.ListUploadsPage(ctx, db.ListUploadsPageParams{
+		OrgID:         auth.OrgID(ctx),
+		EnvID:         auth.EnvID(ctx),
+		Status:        status,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		CreatorID:     params.CreatorID,
+		Tag:           params.Tag,
+		CursorTime:    params.CursorTime,
+		CursorID:      params.CursorID,
+		SortBy:        params.SortBy,
+		SortDesc:      params.SortDesc,
+		Limit:         params.Limit,
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to list videos: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	total, err := h.Queries.CountUploads(ctx, db.CountUploadsParams{
+		OrgID:         auth.OrgID(ctx),
+		EnvID:         auth.EnvID(ctx),
+		Status:        status,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		CreatorID:     params.CreatorID,
+		Tag:           params.Tag,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count videos: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	next := ""
+	if len(videos) > 0 {
+		last := videos[len(videos)-1]
+		next = params.nextCursor(len(videos), last.CreatedAt, last.UpdatedAt, last.ID)
+	}
+	writePageHeaders(w, r, total, next)
+
+	if videos == nil {
+		videos = []db.Upload{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(videos)
 }
@@ -66,7 +289,11 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := h.Queries.GetUpload(r.Context(), pgUUID)
+	video, err := h.Queries.GetUpload(r.Context(), db.GetUploadParams{
+		ID:    pgUUID,
+		OrgID: auth.OrgID(r.Context()),
+		EnvID: auth.EnvID(r.Context()),
+	})
 	if err != nil {
 		http.Error(w, "Video not found", http.StatusNotFound)
 		return
@@ -77,7 +304,22 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 type CreateUploadRequest struct {
-	Filename string `json:"filename"`
+	Filename    string          `json:"filename"`
+	Title       string          `json:"title,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	CreatorID   *string         `json:"creator_id,omitempty"`
+	ExternalID  *string         `json:"external_id,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	// Deduplicate links the upload to the renditions of an identical,
+	// already processed file instead of transcoding it again. Defaults to true.
+	Deduplicate *bool `json:"deduplicate,omitempty"`
+	// Encrypt produces AES-128 encrypted renditions whose keys are only
+	// served with a playback token. Defaults to false.
+	Encrypt *bool `json:"encrypt,omitempty"`
+	// DRMScheme produces CMAF renditions (DASH and fMP4 HLS) encrypted
+	// with Common Encryption, "cenc" or "cbcs", for Clear Key players.
+	DRMScheme *string `json:"drm_scheme,omitempty"`
 }
 
 type CreateUploadResponse struct {
@@ -98,13 +340,24 @@ func (h *Handler) CreateUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Title == "" {
+		req.Title = req.Filename
+	}
+
+	metadata, err := normalizeMetadata(req.Metadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Generate a unique ID for the video
 	videoID := uuid.New()
 	ext := filepath.Ext(req.Filename)
 	if ext == "" {
 		ext = ".mp4"
 	}
-	key := fmt.Sprintf("original/%s%s", videoID.String(), ext)
+	orgID := auth.OrgID(r.Context())
+	key := storage.OriginalKey(uuid.UUID(orgID.Bytes).String(), videoID.String(), ext)
 
 	// Generate presigned URL
 	ctx := r.Context()
@@ -114,22 +367,77 @@ func (h *Handler) CreateUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deduplicate, encrypt := true, false
+	env, _ := auth.Environment(ctx)
+	settings := auth.ParseEnvironmentSettings(env.Settings)
+	if settings.Deduplicate != nil {
+		deduplicate = *settings.Deduplicate
+	}
+	if req.Deduplicate != nil {
+		deduplicate = *req.Deduplicate
+	}
+	if settings.Encrypt != nil {
+		encrypt = *settings.Encrypt
+	}
+	if req.Encrypt != nil {
+		encrypt = *req.Encrypt
+	}
+	var drmScheme pgtype.Text
+	if settings.DRMScheme != "" {
+		drmScheme = pgtype.Text{String: settings.DRMScheme, Valid: true}
+	}
+	if req.DRMScheme != nil {
+		drmScheme = optionalText(req.DRMScheme)
+	}
+	if drmScheme.Valid {
+		if !keys.ValidScheme(drmScheme.String) {
+			http.Error(w, "drm_scheme must be cenc or cbcs", http.StatusBadRequest)
+			return
+		}
+		encrypt = true
+	}
+
 	// Save to database
 	var pgUUID pgtype.UUID
 	pgUUID.Scan(videoID.String())
 
-	_, err = h.Queries.CreateUpload(ctx, db.CreateUploadParams{
-
-		ID:     pgUUID,
-		Title:  req.Filename,
-		S3Key:  key,
-		Status: db.UploadStatusPending,
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		upload, err := q.CreateUpload(ctx, db.CreateUploadParams{
+			ID:          pgUUID,
+			OrgID:       orgID,
+			EnvID:       auth.EnvID(ctx),
+			Title:       req.Title,
+			S3Key:       key,
+			Status:      db.UploadStatusPending,
+			Deduplicate: deduplicate,
+			Description: optionalText(req.Description),
+			CreatorID:   optionalText(req.CreatorID),
+			ExternalID:  optionalText(req.ExternalID),
+			Metadata:    metadata,
+			Tags:        tagsOrEmpty(req.Tags),
+			Encrypt:     encrypt,
+			DrmScheme:   drmScheme,
+		})
+		if err != nil {
+			return err
+		}
+		return webhooks.Record(ctx, q, events.SourceAPI, events.UploadCreatedV1{
+			UploadData: events.NewUploadData(upload),
+			Title:      upload.Title,
+		})
 	})
+	if isUniqueViolation(err) {
+		http.Error(w, "An upload with this external_id already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create upload record: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	auth.Audit(ctx, h.Queries, "upload.create", "upload", videoID.String())
+
 	resp := CreateUploadResponse{
 		ID:        videoID.String(),
 		UploadURL: uploadURL,
@@ -149,24 +457,183 @@ func (h *Handler) GetAsset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	asset, err := h.Queries.GetAsset(r.Context(), pgUUID)
+	asset, err := h.findAsset(r.Context(), pgUUID)
+	if err != nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
+
+// findAsset looks an asset up by its ID or, failing that, by the ID of
+// its upload, within the request's environment.
+func (h *Handler) findAsset(ctx context.Context, id pgtype.UUID) (db.Asset, error) {
+	orgID, envID := auth.OrgID(ctx), auth.EnvID(ctx)
+
+	asset, err := h.Queries.GetAsset(ctx, db.GetAssetParams{ID: id, OrgID: orgID, EnvID: envID})
 	if err != nil {
 		// Try to find by upload ID as well, just in case user passed upload ID
-		asset, err = h.Queries.GetAssetByUploadID(r.Context(), pgUUID)
+		asset, err = h.Queries.GetAssetByUploadID(ctx, db.GetAssetByUploadIDParams{UploadID: id, OrgID: orgID, EnvID: envID})
+	}
+	return asset, err
+}
+
+// UpdateAssetRequest changes the fields it contains. Null or empty values
+// clear description, creator_id, external_id, tags and transcript.
+type UpdateAssetRequest struct {
+	Title       *string            `json:"title,omitempty"`
+	Description nullable[string]   `json:"description"`
+	CreatorID   nullable[string]   `json:"creator_id"`
+	ExternalID  nullable[string]   `json:"external_id"`
+	Metadata    json.RawMessage    `json:"metadata,omitempty"`
+	Tags        nullable[[]string] `json:"tags"`
+	Transcript  nullable[string]   `json:"transcript"`
+	// Visibility is public, unlisted or private.
+	Visibility     *string                `json:"visibility,omitempty"`
+	PlaybackPolicy *PlaybackPolicyRequest `json:"playback_policy,omitempty"`
+}
+
+// PlaybackPolicyRequest changes the fields it contains. A null or empty
+// allowed_referrers list, a null or "0" token_ttl and a null or 0
+// max_tokens remove the respective restriction.
+type PlaybackPolicyRequest struct {
+	AllowedReferrers nullable[[]string] `json:"allowed_referrers"`
+	// TokenTTL caps the lifetime of playback tokens, e.g. "15m".
+	TokenTTL  nullable[string] `json:"token_ttl"`
+	MaxTokens nullable[int32]  `json:"max_tokens"`
+}
+
+// apply validates the policy and copies it into params.
+func (p *PlaybackPolicyRequest) apply(params *db.UpdateAssetMetadataParams) error {
+	if p.AllowedReferrers.Value != nil {
+		referrers := make([]string, 0, len(*p.AllowedReferrers.Value))
+		for _, d := range *p.AllowedReferrers.Value {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if !playback.ValidReferrerDomain(d) {
+				return fmt.Errorf("invalid referrer domain %q", d)
+			}
+			referrers = append(referrers, d)
+		}
+		params.AllowedReferrers = referrers
+	}
+	params.SetAllowedReferrers = p.AllowedReferrers.Set
+	if p.TokenTTL.Value != nil {
+		ttl, err := time.ParseDuration(*p.TokenTTL.Value)
+		if err != nil || ttl < 0 || ttl > playback.MaxTokenTTL {
+			return fmt.Errorf("token_ttl must be a duration of at most %s", playback.MaxTokenTTL)
+		}
+		params.TokenTtlSeconds = pgtype.Int4{Int32: int32(ttl / time.Second), Valid: true}
+	}
+	params.SetTokenTtlSeconds = p.TokenTTL.Set
+	if p.MaxTokens.Value != nil {
+		if *p.MaxTokens.Value < 0 {
+			return fmt.Errorf("max_tokens must not be negative")
+		}
+		params.MaxTokens = pgtype.Int4{Int32: *p.MaxTokens.Value, Valid: true}
+	}
+	params.SetMaxTokens = p.MaxTokens.Set
+	return nil
+}
+
+func (h *Handler) UpdateAsset(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var pgUUID pgtype.UUID
+	err := pgUUID.Scan(idStr)
+	if err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateAssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	params := db.UpdateAssetMetadataParams{
+		ID:      pgUUID,
+		OrgID:   auth.OrgID(r.Context()),
+		EnvID:   auth.EnvID(r.Context()),
+		Title:   optionalText(req.Title),
+		SetTags: req.Tags.Set,
+	}
+	params.SetDescription, params.Description = clearableText(req.Description)
+	params.SetCreatorID, params.CreatorID = clearableText(req.CreatorID)
+	params.SetExternalID, params.ExternalID = clearableText(req.ExternalID)
+	params.SetTranscript, params.Transcript = clearableText(req.Transcript)
+	if req.Tags.Value != nil {
+		params.Tags = *req.Tags.Value
+	}
+	if req.Metadata != nil {
+		metadata, err := normalizeMetadata(req.Metadata)
 		if err != nil {
-			http.Error(w, "Asset not found", http.StatusNotFound)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Metadata = metadata
+	}
+	if req.Visibility != nil {
+		v := db.AssetVisibility(*req.Visibility)
+		switch v {
+		case db.AssetVisibilityPublic, db.AssetVisibilityUnlisted, db.AssetVisibilityPrivate:
+		default:
+			http.Error(w, "visibility must be public, unlisted or private", http.StatusBadRequest)
+			return
+		}
+		params.Visibility = db.NullAssetVisibility{AssetVisibility: v, Valid: true}
+	}
+	if req.PlaybackPolicy != nil {
+		if err := req.PlaybackPolicy.apply(&params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
 
+	asset, err := h.Queries.UpdateAssetMetadata(r.Context(), params)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "An asset with this external_id already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update asset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	auth.Audit(r.Context(), h.Queries, "asset.update", "asset", idStr)
+
+	if req.Visibility != nil {
+		if err := h.Playback.SyncBucketPolicy(r.Context()); err != nil {
+			log.Printf("Failed to sync bucket policy: %v", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(asset)
 }
 
 type GetAssetPlaylistResponse struct {
+	// URL is the master playlist: the bucket URL for public assets,
+	// otherwise the playback proxy with the token included.
 	URL string `json:"url"`
+	// DashURL and LicenseURL are set for assets encrypted with Common
+	// Encryption: the DASH manifest and the Clear Key license endpoint.
+	DashURL    string     `json:"dash_url,omitempty"`
+	LicenseURL string     `json:"license_url,omitempty"`
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 }
 
+// GetAssetPlaylist returns the playlist URL allowed by the asset's
+// visibility and playback policy. For unlisted and private assets the
+// token can be restricted further with ?ttl= (e.g. 30m, at most 24h), ?ip=
+// or ?bind_ip=true for the caller's address, and ?referrer= for the origin
+// the player is embedded on.
 func (h *Handler) GetAssetPlaylist(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	var pgUUID pgtype.UUID
@@ -176,14 +643,10 @@ func (h *Handler) GetAssetPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	asset, err := h.Queries.GetAsset(r.Context(), pgUUID)
+	asset, err := h.findAsset(r.Context(), pgUUID)
 	if err != nil {
-		// Try to find by upload ID as well, just in case user passed upload ID
-		asset, err = h.Queries.GetAssetByUploadID(r.Context(), pgUUID)
-		if err != nil {
-			http.Error(w, "Asset not found", http.StatusNotFound)
-			return
-		}
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
 	}
 
 	if asset.Status != db.AssetStatusReady {
@@ -191,25 +654,46 @@ func (h *Handler) GetAssetPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	key := asset.HlsRoot
-	presignedURL, err := h.Storage.GeneratePresignedGetURL(r.Context(), key)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate playlist URL: %v", err), http.StatusInternalServerError)
-		return
+	query := r.URL.Query()
+	req := playback.Request{
+		TokenOptions: playback.TokenOptions{
+			IP:       query.Get("ip"),
+			Referrer: query.Get("referrer"),
+		},
+		ClientIP:      playback.ClientIP(r),
+		RefererOrigin: playback.RefererOrigin(r),
+	}
+	if v := query.Get("ttl"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		req.TTL = ttl
+	}
+	if query.Get("bind_ip") == "true" {
+		req.IP = req.ClientIP
 	}
 
-	// Since the bucket is public for HLS, we can strip the query parameters
-	// to provide a cleaner URL and avoid expiration issues.
-	u, err := url.Parse(presignedURL)
+	grant, err := h.Playback.Grant(r.Context(), asset, req)
+	if errors.Is(err, playback.ErrReferrerRequired) || errors.Is(err, playback.ErrReferrerNotAllowed) || errors.Is(err, playback.ErrTooManyTokens) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse URL: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to issue playback URL: %v", err), http.StatusInternalServerError)
 		return
 	}
-	u.RawQuery = ""
-	finalURL := u.String()
 
-	resp := GetAssetPlaylistResponse{
-		URL: finalURL,
+	resp := GetAssetPlaylistResponse{URL: grant.URL}
+	if grant.Path != "" {
+		resp.URL = playback.BaseURL(r) + grant.Path
+		resp.Token = grant.Token
+		resp.ExpiresAt = &grant.ExpiresAt
+	}
+	if grant.DashPath != "" {
+		resp.DashURL = playback.BaseURL(r) + grant.DashPath
+		resp.LicenseURL = playback.BaseURL(r) + grant.LicensePath
 	}
 
 	w.Header().Set("Content-Type", "application/json")
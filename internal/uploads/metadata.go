@@ -0,0 +1,120 @@
+package uploads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// normalizeMetadata checks that raw is a JSON object, defaulting to an
+// empty one.
+func normalizeMetadata(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage("{}"), nil
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object")
+	}
+	return raw, nil
+}
+
+// metadataFilter builds a containment filter from "metadata.<key>=<value>"
+// query parameters and the list of keys that must be present from
+// "has_metadata=<key>,<key>". It returns a nil filter when none is given.
+func metadataFilter(query url.Values) (json.RawMessage, []string, error) {
+	values := map[string]string{}
+	for param, v := range query {
+		key, ok := strings.CutPrefix(param, "metadata.")
+		if !ok {
+			continue
+		}
+		if key == "" {
+			return nil, nil, fmt.Errorf("metadata key is required")
+		}
+		values[key] = v[0]
+	}
+
+	keys := []string{}
+	if has := query.Get("has_metadata"); has != "" {
+		keys = strings.Split(has, ",")
+	}
+
+	if len(values) == 0 {
+		return nil, keys, nil
+	}
+
+	filter, err := json.Marshal(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, keys, nil
+}
+
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// nullable is a field of a PATCH request. Set reports whether the request
+// contains the field at all, so that an explicit null can clear it.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	n.Value = new(T)
+	return json.Unmarshal(data, n.Value)
+}
+
+// clearableText maps a PATCH text field to its set flag and value. Null
+// and the empty string clear the field.
+func clearableText(n nullable[string]) (bool, pgtype.Text) {
+	if n.Value == nil || *n.Value == "" {
+		return n.Set, pgtype.Text{}
+	}
+	return true, pgtype.Text{String: *n.Value, Valid: true}
+}
+
+func optionalText(s *string) pgtype.Text {
+	if s == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: *s, Valid: true}
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func validAssetStatus(s db.AssetStatus) bool {
+	switch s {
+	case db.AssetStatusProcessing, db.AssetStatusReady, db.AssetStatusFailed:
+		return true
+	}
+	return false
+}
+
+func validUploadStatus(s db.UploadStatus) bool {
+	switch s {
+	case db.UploadStatusPending, db.UploadStatusUploaded, db.UploadStatusProcessing, db.UploadStatusReady, db.UploadStatusFailed:
+		return true
+	}
+	return false
+}
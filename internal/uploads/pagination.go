@@ -0,0 +1,151 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// listParams holds the pagination, filtering and sorting options shared by
+// the list endpoints.
+type listParams struct {
+	Limit         int32
+	SortBy        string
+	SortDesc      bool
+	CursorTime    pgtype.Timestamptz
+	CursorID      pgtype.UUID
+	Status        string
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	CreatorID     pgtype.Text
+	Tag           pgtype.Text
+}
+
+type cursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// parseListParams reads ?limit=&cursor=&sort=&status=&created_after=
+// &created_before=&creator_id=&tag= from the query string. sort is a field
+// name, optionally prefixed with "-" for descending order; the default is
+// "-created_at".
+func parseListParams(query url.Values) (listParams, error) {
+	p := listParams{
+		Limit:    defaultPageLimit,
+		SortBy:   "created_at",
+		SortDesc: true,
+		Status:   query.Get("status"),
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return p, fmt.Errorf("invalid limit")
+		}
+		p.Limit = int32(min(limit, maxPageLimit))
+	}
+
+	if v := query.Get("sort"); v != "" {
+		p.SortDesc = strings.HasPrefix(v, "-")
+		p.SortBy = strings.TrimPrefix(v, "-")
+		if p.SortBy != "created_at" && p.SortBy != "updated_at" {
+			return p, fmt.Errorf("invalid sort, expected created_at or updated_at")
+		}
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid cursor")
+		}
+		p.CursorTime = pgtype.Timestamptz{Time: c.Time, Valid: true}
+		if err := p.CursorID.Scan(c.ID); err != nil {
+			return p, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	var err error
+	if p.CreatedAfter, err = parseTime(query.Get("created_after")); err != nil {
+		return p, fmt.Errorf("invalid created_after: %w", err)
+	}
+	if p.CreatedBefore, err = parseTime(query.Get("created_before")); err != nil {
+		return p, fmt.Errorf("invalid created_before: %w", err)
+	}
+
+	if v := query.Get("creator_id"); v != "" {
+		p.CreatorID = pgtype.Text{String: v, Valid: true}
+	}
+	if v := query.Get("tag"); v != "" {
+		p.Tag = pgtype.Text{String: v, Valid: true}
+	}
+
+	return p, nil
+}
+
+func parseTime(v string) (pgtype.Timestamptz, error) {
+	if v == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
+
+// nextCursor returns the cursor pointing after the last row of a full page,
+// or "" when there are no more rows.
+func (p listParams) nextCursor(n int, createdAt, updatedAt pgtype.Timestamptz, id pgtype.UUID) string {
+	if n < int(p.Limit) {
+		return ""
+	}
+
+	c := cursor{Time: createdAt.Time, ID: uuid.UUID(id.Bytes).String()}
+	if p.SortBy == "updated_at" {
+		c.Time = updatedAt.Time
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// writePageHeaders sets X-Total-Count and, when there is a next page,
+// X-Next-Cursor and a Link header with rel="next".
+func writePageHeaders(w http.ResponseWriter, r *http.Request, total int64, next string) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if next == "" {
+		return
+	}
+
+	w.Header().Set("X-Next-Cursor", next)
+
+	u := *r.URL
+	query := u.Query()
+	query.Set("cursor", next)
+	u.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.String()))
+}
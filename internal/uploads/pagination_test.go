@@ -0,0 +1,202 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseListParams(t *testing.T) {
+	id := uuid.MustParse("6f1c7b9e-3a52-4d8e-9b1f-2c4d5e6f7a8b")
+	at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	validCursor := listParams{Limit: 1}.nextCursor(1,
+		pgtype.Timestamptz{Time: at, Valid: true},
+		pgtype.Timestamptz{},
+		pgtype.UUID{Bytes: id, Valid: true},
+	)
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+		check   func(t *testing.T, p listParams)
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			check: func(t *testing.T, p listParams) {
+				if p.Limit != defaultPageLimit || p.SortBy != "created_at" || !p.SortDesc {
+					t.Errorf("got limit %d sort %q desc %v, want %d created_at true", p.Limit, p.SortBy, p.SortDesc, defaultPageLimit)
+				}
+				if p.CursorTime.Valid || p.CursorID.Valid || p.CreatedAfter.Valid || p.CreatedBefore.Valid || p.CreatorID.Valid || p.Tag.Valid {
+					t.Errorf("got optional filters set: %+v", p)
+				}
+			},
+		},
+		{
+			name:  "limit",
+			query: "limit=10",
+			check: func(t *testing.T, p listParams) {
+				if p.Limit != 10 {
+					t.Errorf("got limit %d, want 10", p.Limit)
+				}
+			},
+		},
+		{
+			name:  "limit is capped",
+			query: "limit=100000",
+			check: func(t *testing.T, p listParams) {
+				if p.Limit != maxPageLimit {
+					t.Errorf("got limit %d, want %d", p.Limit, maxPageLimit)
+				}
+			},
+		},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "negative limit", query: "limit=-1", wantErr: true},
+		{name: "non-numeric limit", query: "limit=ten", wantErr: true},
+		{
+			name:  "ascending sort",
+			query: "sort=updated_at",
+			check: func(t *testing.T, p listParams) {
+				if p.SortBy != "updated_at" || p.SortDesc {
+					t.Errorf("got sort %q desc %v, want updated_at false", p.SortBy, p.SortDesc)
+				}
+			},
+		},
+		{
+			name:  "descending sort",
+			query: "sort=-updated_at",
+			check: func(t *testing.T, p listParams) {
+				if p.SortBy != "updated_at" || !p.SortDesc {
+					t.Errorf("got sort %q desc %v, want updated_at true", p.SortBy, p.SortDesc)
+				}
+			},
+		},
+		{name: "unknown sort field", query: "sort=title", wantErr: true},
+		{name: "sql in sort", query: "sort=created_at%3BDROP+TABLE+uploads", wantErr: true},
+		{
+			name:  "cursor",
+			query: "cursor=" + validCursor,
+			check: func(t *testing.T, p listParams) {
+				if !p.CursorTime.Valid || !p.CursorTime.Time.Equal(at) {
+					t.Errorf("got cursor time %v, want %v", p.CursorTime, at)
+				}
+				if !p.CursorID.Valid || uuid.UUID(p.CursorID.Bytes) != id {
+					t.Errorf("got cursor id %v, want %v", p.CursorID, id)
+				}
+			},
+		},
+		{name: "cursor is not base64", query: "cursor=!!!", wantErr: true},
+		{name: "cursor is not json", query: "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("nope")), wantErr: true},
+		{name: "cursor id is not a uuid", query: "cursor=" + base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-10-19T12:00:00Z","id":"42"}`)), wantErr: true},
+		{
+			name:  "filters",
+			query: "status=ready&created_after=2026-10-01T00:00:00Z&created_before=2026-10-19T00:00:00Z&creator_id=alice&tag=demo",
+			check: func(t *testing.T, p listParams) {
+				if p.Status != "ready" {
+					t.Errorf("got status %q, want ready", p.Status)
+				}
+				if !p.CreatedAfter.Valid || !p.CreatedAfter.Time.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("got created_after %v", p.CreatedAfter)
+				}
+				if !p.CreatedBefore.Valid || !p.CreatedBefore.Time.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("got created_before %v", p.CreatedBefore)
+				}
+				if p.CreatorID != (pgtype.Text{String: "alice", Valid: true}) || p.Tag != (pgtype.Text{String: "demo", Valid: true}) {
+					t.Errorf("got creator_id %v tag %v", p.CreatorID, p.Tag)
+				}
+			},
+		},
+		{name: "invalid created_after", query: "created_after=yesterday", wantErr: true},
+		{name: "invalid created_before", query: "created_before=2026-10-19", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := parseListParams(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListParams(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, p)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		cursor  string
+		want    cursor
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			cursor: encode(`{"t":"2026-10-19T12:00:00Z","id":"6f1c7b9e-3a52-4d8e-9b1f-2c4d5e6f7a8b"}`),
+			want:   cursor{Time: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), ID: "6f1c7b9e-3a52-4d8e-9b1f-2c4d5e6f7a8b"},
+		},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"id":"x"}`)), wantErr: true},
+		{name: "standard base64 alphabet", cursor: "+/+/", wantErr: true},
+		{name: "not json", cursor: encode("cursor"), wantErr: true},
+		{name: "invalid time", cursor: encode(`{"t":"yesterday"}`), wantErr: true},
+		{name: "empty object", cursor: encode(`{}`), want: cursor{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCursor(%q) error = %v, wantErr %v", tt.cursor, err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Time.Equal(tt.want.Time) || got.ID != tt.want.ID) {
+				t.Errorf("decodeCursor(%q) = %+v, want %+v", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextCursorRoundTrip(t *testing.T) {
+	id := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	created := pgtype.Timestamptz{Time: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+	updated := pgtype.Timestamptz{Time: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), Valid: true}
+
+	tests := []struct {
+		name   string
+		params listParams
+		n      int
+		want   time.Time
+		last   bool
+	}{
+		{"short page", listParams{Limit: 10, SortBy: "created_at"}, 9, time.Time{}, true},
+		{"by created_at", listParams{Limit: 10, SortBy: "created_at"}, 10, created.Time, false},
+		{"by updated_at", listParams{Limit: 10, SortBy: "updated_at"}, 10, updated.Time, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := tt.params.nextCursor(tt.n, created, updated, id)
+			if tt.last {
+				if next != "" {
+					t.Errorf("got cursor %q for the last page, want none", next)
+				}
+				return
+			}
+
+			c, err := decodeCursor(next)
+			if err != nil {
+				t.Fatalf("decodeCursor(%q): %v", next, err)
+			}
+			if !c.Time.Equal(tt.want) || c.ID != uuid.UUID(id.Bytes).String() {
+				t.Errorf("got cursor %+v, want time %v and id %v", c, tt.want, uuid.UUID(id.Bytes))
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package uploads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type PromoteAssetRequest struct {
+	// Environment is the name of the environment to copy the asset to.
+	Environment string `json:"environment"`
+}
+
+// PromoteAsset copies a ready asset, e.g. from qa to prod. The renditions
+// are copied within the bucket, so nothing is transcoded again, and the
+// copy records the asset it was promoted from.
+func (h *Handler) PromoteAsset(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var pgUUID pgtype.UUID
+	if err := pgUUID.Scan(idStr); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return
+	}
+
+	var req PromoteAssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Environment == "" {
+		http.Error(w, "Environment is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	asset, err := h.findAsset(ctx, pgUUID)
+	if err != nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if asset.Status != db.AssetStatusReady {
+		http.Error(w, "Asset is not ready", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.Queries.GetEnvironmentByName(ctx, db.GetEnvironmentByNameParams{
+		OrgID: asset.OrgID,
+		Name:  req.Environment,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Environment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get environment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if target.ID == asset.EnvID {
+		http.Error(w, "Asset is already in this environment", http.StatusBadRequest)
+		return
+	}
+
+	// hls_root is "hls/<orgId>/<assetId>/master.m3u8"
+	assetID := uuid.New()
+	srcPrefix := path.Dir(asset.HlsRoot) + "/"
+	dstPrefix := fmt.Sprintf("%s%s/", storage.HLSPrefix(uuid.UUID(asset.OrgID.Bytes).String()), assetID.String())
+
+	if _, err := h.Storage.CopyPrefix(ctx, srcPrefix, dstPrefix); err != nil {
+		h.removePromoted(ctx, dstPrefix)
+		http.Error(w, fmt.Sprintf("Failed to copy renditions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var pgAssetID pgtype.UUID
+	pgAssetID.Scan(assetID.String())
+
+	// The asset and its content keys commit together; if either fails the
+	// copied renditions are removed again
+	var promoted db.Asset
+	err = pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		var err error
+		promoted, err = q.CopyAsset(ctx, db.CopyAssetParams{
+			ID:       pgAssetID,
+			EnvID:    target.ID,
+			HlsRoot:  dstPrefix + path.Base(asset.HlsRoot),
+			SourceID: asset.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The copied segments are encrypted with the source's keys
+		if promoted.Encrypted {
+			err := q.CopyAssetKeys(ctx, db.CopyAssetKeysParams{
+				AssetID:  promoted.ID,
+				SourceID: asset.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("copy content keys: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.removePromoted(ctx, dstPrefix)
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "An asset with this external_id already exists in "+target.Name, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create promoted asset: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	auth.Audit(ctx, h.Queries, "asset.promote", "asset", assetID.String())
+
+	// The copy lives under a new prefix which the bucket policy must cover
+	if promoted.Visibility == db.AssetVisibilityPublic {
+		if err := h.Playback.SyncBucketPolicy(ctx); err != nil {
+			log.Printf("Failed to sync bucket policy: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promoted)
+}
+
+// removePromoted deletes renditions copied for a promotion that failed. It
+// runs even if the request was canceled, which may be why it failed.
+func (h *Handler) removePromoted(ctx context.Context, prefix string) {
+	if _, err := h.Storage.DeletePrefix(context.WithoutCancel(ctx), prefix); err != nil {
+		log.Printf("Failed to delete promoted renditions %s: %v", prefix, err)
+	}
+}
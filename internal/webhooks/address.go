@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var errForbiddenAddress = errors.New("webhook endpoints must not resolve to loopback, link-local, private or unspecified addresses")
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+// and home to some cloud metadata services.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbiddenIP reports whether ip is internal to the network Gamma runs in,
+// which endpoints must not reach.
+func forbiddenIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// checkHost resolves the host of an endpoint URL and rejects it when any
+// of its addresses is forbidden.
+func checkHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if forbiddenIP(ip) {
+			return errForbiddenAddress
+		}
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s", host)
+	}
+	for _, ip := range ips {
+		if forbiddenIP(ip) {
+			return errForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// newClient returns the HTTP client for deliveries. It checks every
+// address it connects to, so neither DNS changes after an endpoint was
+// created nor redirects reach internal services.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if forbiddenIP(ip) {
+				return errForbiddenAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect on our behalf, bypassing the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   deliveryTimeout,
+	}
+}
@@ -0,0 +1,104 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		// Public
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+		{"100.63.255.255", false},
+		{"100.128.0.0", false},
+		// Loopback
+		{"127.0.0.1", true},
+		{"127.255.255.254", true},
+		{"::1", true},
+		// Private
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"fd00::1", true},
+		// Unspecified
+		{"0.0.0.0", true},
+		{"::", true},
+		// Link-local, including cloud metadata services
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		// Multicast
+		{"224.0.0.1", true},
+		{"239.255.255.250", true},
+		{"ff02::1", true},
+		{"ff01::1", true},
+		// Carrier-grade NAT
+		{"100.64.0.1", true},
+		{"100.100.100.200", true},
+		// IPv4-mapped IPv6 addresses are checked as IPv4
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := forbiddenIP(netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("forbiddenIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr error
+	}{
+		{"8.8.8.8", nil},
+		{"2606:4700:4700::1111", nil},
+		{"127.0.0.1", errForbiddenAddress},
+		{"169.254.169.254", errForbiddenAddress},
+		{"::1", errForbiddenAddress},
+		{"::ffff:192.168.0.1", errForbiddenAddress},
+		// Resolved through /etc/hosts, so no network is needed
+		{"localhost", errForbiddenAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := checkHost(context.Background(), tt.host)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkHost(%q) = %v, want %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckHostUnresolvable(t *testing.T) {
+	// .invalid never resolves (RFC 2606)
+	err := checkHost(context.Background(), "gamma.invalid")
+	if err == nil || errors.Is(err, errForbiddenAddress) {
+		t.Errorf("checkHost(gamma.invalid) = %v, want a resolution error", err)
+	}
+}
+
+func TestClientRefusesForbiddenAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery reached a loopback server")
+	}))
+	defer srv.Close()
+
+	_, err := newClient().Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Errorf("POST %s = %v, want %v", srv.URL, err, errForbiddenAddress)
+	}
+}
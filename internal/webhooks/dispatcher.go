@@ -0,0 +1,246 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it fails.
+	MaxAttempts = 10
+	// deliveryTimeout bounds a single attempt.
+	deliveryTimeout = 10 * time.Second
+	// Retries wait baseBackoff, doubling after each failed attempt, at most
+	// maxBackoff: about 2.8 hours over all attempts.
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Dispatcher consumes events and deliveries from JetStream. Several API
+// instances can run one; the durable queue consumers share the work.
+type Dispatcher struct {
+	Queries  *db.Queries
+	EventBus *events.EventBus
+	Client   *http.Client
+}
+
+func NewDispatcher(queries *db.Queries, eventBus *events.EventBus) *Dispatcher {
+	return &Dispatcher{
+		Queries:  queries,
+		EventBus: eventBus,
+		Client:   newClient(),
+	}
+}
+
+// Start subscribes to events and deliveries.
+func (d *Dispatcher) Start() error {
+	if err := EnsureStream(d.EventBus); err != nil {
+		return fmt.Errorf("failed to ensure webhook stream: %w", err)
+	}
+
+	_, err := d.EventBus.Subscribe(EventSubject, "webhook-dispatcher", d.handleEvent)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to webhook events: %w", err)
+	}
+
+	// Retries are scheduled with NakWithDelay, so JetStream must not give
+	// up before MaxAttempts, and attempts must finish within AckWait
+	_, err = d.EventBus.Subscribe(DeliverySubject, "webhook-deliveries", d.handleDelivery,
+		nats.AckWait(2*deliveryTimeout),
+		nats.MaxDeliver(-1),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// handleEvent creates a delivery for every endpoint wanting the event.
+// Redelivered events reuse the deliveries created before.
+func (d *Dispatcher) handleEvent(msg *nats.Msg) {
+	event, err := events.ParseCloudEvent(msg.Data)
+	if err != nil {
+		log.Printf("Failed to unmarshal webhook event: %v", err)
+		msg.Term()
+		return
+	}
+	eventType, ok := eventTypes[event.Type]
+	if !ok {
+		log.Printf("Ignoring webhook event %s of type %s", event.ID, event.Type)
+		msg.Term()
+		return
+	}
+	var s scope
+	if err := json.Unmarshal(event.Data, &s); err != nil {
+		log.Printf("Failed to unmarshal data of webhook event %s: %v", event.ID, err)
+		msg.Term()
+		return
+	}
+
+	ctx := context.Background()
+	var orgID, envID, eventID pgtype.UUID
+	orgID.Scan(s.OrgID)
+	envID.Scan(s.EnvID)
+	eventID.Scan(event.ID)
+
+	endpoints, err := d.Queries.ListWebhookEndpointsForEvent(ctx, db.ListWebhookEndpointsForEventParams{
+		OrgID:     orgID,
+		EnvID:     envID,
+		EventType: eventType,
+	})
+	if err != nil {
+		log.Printf("Failed to list webhook endpoints for event %s: %v", event.ID, err)
+		msg.Nak()
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		delivery, err := d.Queries.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+			ID:         newUUID(),
+			EndpointID: endpoint.ID,
+			EventID:    eventID,
+			EventType:  eventType,
+			Payload:    msg.Data,
+		})
+		if err != nil {
+			log.Printf("Failed to create webhook delivery for event %s: %v", event.ID, err)
+			msg.Nak()
+			return
+		}
+		if delivery.Status != db.WebhookDeliveryStatusPending {
+			continue
+		}
+		if err := Enqueue(d.EventBus, delivery.ID); err != nil {
+			log.Printf("Failed to enqueue webhook delivery: %v", err)
+			msg.Nak()
+			return
+		}
+	}
+
+	msg.Ack()
+}
+
+// Enqueue schedules an attempt of a pending delivery.
+func Enqueue(bus *events.EventBus, deliveryID pgtype.UUID) error {
+	return bus.Publish(DeliverySubject, []byte(uuid.UUID(deliveryID.Bytes).String()))
+}
+
+// handleDelivery makes one attempt and records it. Failed attempts are
+// retried by negatively acknowledging the message with the backoff delay.
+func (d *Dispatcher) handleDelivery(msg *nats.Msg) {
+	ctx := context.Background()
+
+	var id pgtype.UUID
+	if err := id.Scan(string(msg.Data)); err != nil {
+		log.Printf("Invalid webhook delivery message %q", msg.Data)
+		msg.Term()
+		return
+	}
+
+	delivery, err := d.Queries.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		// Deleted along with its endpoint
+		msg.Term()
+		return
+	}
+	if delivery.Status != db.WebhookDeliveryStatusPending {
+		msg.Ack()
+		return
+	}
+
+	endpoint, err := d.Queries.GetWebhookEndpointByID(ctx, delivery.EndpointID)
+	if err != nil {
+		msg.Term()
+		return
+	}
+
+	status, attemptErr := d.attempt(ctx, endpoint, delivery)
+
+	params := db.RecordWebhookAttemptParams{
+		ID:     delivery.ID,
+		Status: db.WebhookDeliveryStatusSucceeded,
+	}
+	if status != 0 {
+		params.ResponseStatus = pgtype.Int4{Int32: int32(status), Valid: true}
+	}
+
+	var retryIn time.Duration
+	if attemptErr != nil {
+		params.LastError = pgtype.Text{String: attemptErr.Error(), Valid: true}
+		params.Status = db.WebhookDeliveryStatusFailed
+		if attempts := delivery.Attempts + 1; attempts < MaxAttempts {
+			retryIn = backoff(int(attempts))
+			params.Status = db.WebhookDeliveryStatusPending
+			params.NextAttemptAt = pgtype.Timestamptz{Time: time.Now().Add(retryIn), Valid: true}
+		}
+	}
+
+	if _, err := d.Queries.RecordWebhookAttempt(ctx, params); err != nil {
+		log.Printf("Failed to record webhook attempt: %v", err)
+	}
+
+	switch params.Status {
+	case db.WebhookDeliveryStatusPending:
+		msg.NakWithDelay(retryIn)
+	case db.WebhookDeliveryStatusFailed:
+		log.Printf("Webhook delivery %s to %s failed after %d attempts: %v", uuid.UUID(delivery.ID.Bytes), endpoint.Url, MaxAttempts, attemptErr)
+		msg.Term()
+	default:
+		msg.Ack()
+	}
+}
+
+// attempt POSTs the delivery's payload, signed with the endpoint's secret.
+// Any 2xx response counts as success.
+func (d *Dispatcher) attempt(ctx context.Context, endpoint db.WebhookEndpoint, delivery db.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("User-Agent", "Gamma-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now(), delivery.Payload))
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(EventIDHeader, uuid.UUID(delivery.EventID.Bytes).String())
+	req.Header.Set(DeliveryHeader, uuid.UUID(delivery.ID.Bytes).String())
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the delay after the given number of failed attempts.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff << (attempts - 1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+func newUUID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
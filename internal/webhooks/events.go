@@ -0,0 +1,75 @@
+// Package webhooks delivers upload and asset events to the HTTP endpoints
+// organizations register, signed and retried with exponential backoff.
+package webhooks
+
+import (
+	"context"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/outbox"
+)
+
+// Event types delivered to webhook endpoints.
+const (
+	EventUploadCreated   = "upload.created"
+	EventAssetProcessing = "asset.processing"
+	EventAssetReady      = "asset.ready"
+	EventAssetFailed     = "asset.failed"
+	EventAssetDeleted    = "asset.deleted"
+)
+
+// EventTypes lists every event type, in lifecycle order.
+var EventTypes = []string{
+	EventUploadCreated,
+	EventAssetProcessing,
+	EventAssetReady,
+	EventAssetFailed,
+	EventAssetDeleted,
+}
+
+// eventTypes maps the CloudEvents types delivered to webhooks to the event
+// types endpoints subscribe to. A delivery's body is the CloudEvent, so its
+// data follows the published JSON Schema of the CloudEvents type.
+var eventTypes = map[string]string{
+	events.TypeUploadCreatedV1:    EventUploadCreated,
+	events.TypeUploadProcessingV1: EventAssetProcessing,
+	events.TypeAssetProcessedV1:   EventAssetReady,
+	events.TypeUploadFailedV1:     EventAssetFailed,
+	events.TypeAssetDeletedV1:     EventAssetDeleted,
+}
+
+const (
+	// StreamName is the JetStream stream holding events and deliveries.
+	StreamName = "GAMMA_WEBHOOKS"
+	// EventSubject receives every event, whether or not an endpoint
+	// wants it.
+	EventSubject = "gamma.webhooks.events"
+	// DeliverySubject receives one message per delivery to attempt.
+	DeliverySubject = "gamma.webhooks.deliveries"
+)
+
+// EnsureStream creates the webhook stream. Every process running an outbox
+// relay calls it, since publishing fails without it.
+func EnsureStream(bus *events.EventBus) error {
+	return bus.EnsureStream(StreamName, []string{"gamma.webhooks.>"})
+}
+
+// Record adds a typed event from source to the outbox, for the subject of
+// its type and, when webhooks deliver its type, for the dispatcher. Both
+// get the same envelope, so NATS and webhook consumers see one event ID.
+// q should be bound to the transaction making the change the event
+// reports on.
+func Record(ctx context.Context, q *db.Queries, source string, data events.Payload) error {
+	if _, ok := eventTypes[data.EventType()]; !ok {
+		return outbox.AddEvent(ctx, q, source, data)
+	}
+	return outbox.AddEvent(ctx, q, source, data, EventSubject)
+}
+
+// scope is the part of every event's data locating it in an organization
+// and environment.
+type scope struct {
+	OrgID string `json:"org_id"`
+	EnvID string `json:"env_id"`
+}
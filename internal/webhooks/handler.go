@@ -0,0 +1,368 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/auth"
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Handler struct {
+	Queries  *db.Queries
+	EventBus *events.EventBus
+}
+
+func NewHandler(queries *db.Queries, eventBus *events.EventBus) *Handler {
+	return &Handler{
+		Queries:  queries,
+		EventBus: eventBus,
+	}
+}
+
+// RegisterRoutes registers the endpoint management routes. They must be
+// mounted behind auth.Middleware. Endpoints belong to the selected
+// environment, like API keys.
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireOrg, auth.SelectEnvironment(h.Queries), auth.Require(auth.PermWebhooksManage))
+
+		r.Get("/webhooks", h.ListEndpoints)
+		r.Post("/webhooks", h.CreateEndpoint)
+		r.Get("/webhooks/{id}", h.GetEndpoint)
+		r.Delete("/webhooks/{id}", h.DeleteEndpoint)
+		r.Get("/webhooks/{id}/deliveries", h.ListDeliveries)
+		r.Post("/webhooks/{id}/deliveries/{deliveryId}/redeliver", h.Redeliver)
+	})
+}
+
+type EndpointResponse struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newEndpointResponse(e db.WebhookEndpoint) EndpointResponse {
+	resp := EndpointResponse{
+		ID:          uuid.UUID(e.ID.Bytes).String(),
+		URL:         e.Url,
+		EventTypes:  e.EventTypes,
+		Description: e.Description.String,
+		CreatedAt:   e.CreatedAt.Time,
+	}
+	if resp.EventTypes == nil {
+		resp.EventTypes = []string{}
+	}
+	if e.CreatedBy.Valid {
+		resp.CreatedBy = uuid.UUID(e.CreatedBy.Bytes).String()
+	}
+	return resp
+}
+
+type DeliveryResponse struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	ResponseStatus *int32          `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	RedeliveryOf   string          `json:"redelivery_of,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+func newDeliveryResponse(d db.WebhookDelivery) DeliveryResponse {
+	resp := DeliveryResponse{
+		ID:        uuid.UUID(d.ID.Bytes).String(),
+		EventID:   uuid.UUID(d.EventID.Bytes).String(),
+		EventType: d.EventType,
+		Status:    string(d.Status),
+		Attempts:  d.Attempts,
+		LastError: d.LastError.String,
+		Payload:   d.Payload,
+		CreatedAt: d.CreatedAt.Time,
+	}
+	if d.ResponseStatus.Valid {
+		resp.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	if d.NextAttemptAt.Valid && d.Status == db.WebhookDeliveryStatusPending {
+		resp.NextAttemptAt = &d.NextAttemptAt.Time
+	}
+	if d.RedeliveryOf.Valid {
+		resp.RedeliveryOf = uuid.UUID(d.RedeliveryOf.Bytes).String()
+	}
+	if d.DeliveredAt.Valid {
+		resp.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return resp
+}
+
+func (h *Handler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.Queries.ListWebhookEndpoints(r.Context(), db.ListWebhookEndpointsParams{
+		OrgID: auth.OrgID(r.Context()),
+		EnvID: auth.EnvID(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list webhooks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]EndpointResponse, 0, len(endpoints))
+	for _, e := range endpoints {
+		resp = append(resp, newEndpointResponse(e))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type CreateEndpointRequest struct {
+	URL string `json:"url"`
+	// EventTypes filters the events sent to the endpoint, all when empty.
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+}
+
+type CreateEndpointResponse struct {
+	EndpointResponse
+	// Secret signs the deliveries. It is only returned once, at creation.
+	Secret string `json:"secret"`
+}
+
+func (h *Handler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req CreateEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if err := checkHost(r.Context(), u.Hostname()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	eventTypes := []string{}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(EventTypes, t) {
+			http.Error(w, fmt.Sprintf("Invalid event type %q", t), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(eventTypes, t) {
+			eventTypes = append(eventTypes, t)
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	var createdBy pgtype.UUID
+	createdBy.Scan(claims.UserID)
+
+	var description pgtype.Text
+	if req.Description != "" {
+		description = pgtype.Text{String: req.Description, Valid: true}
+	}
+
+	endpoint, err := h.Queries.CreateWebhookEndpoint(r.Context(), db.CreateWebhookEndpointParams{
+		ID:          newUUID(),
+		OrgID:       auth.OrgID(r.Context()),
+		EnvID:       auth.EnvID(r.Context()),
+		Url:         req.URL,
+		Secret:      secret,
+		EventTypes:  eventTypes,
+		Description: description,
+		CreatedBy:   createdBy,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newEndpointResponse(endpoint)
+	auth.Audit(r.Context(), h.Queries, "webhook.create", "webhook", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateEndpointResponse{
+		EndpointResponse: resp,
+		Secret:           secret,
+	})
+}
+
+func (h *Handler) GetEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.findEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newEndpointResponse(endpoint))
+}
+
+func (h *Handler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseUUID(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	n, err := h.Queries.DeleteWebhookEndpoint(r.Context(), db.DeleteWebhookEndpointParams{
+		ID:    id,
+		OrgID: auth.OrgID(r.Context()),
+		EnvID: auth.EnvID(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	auth.Audit(r.Context(), h.Queries, "webhook.delete", "webhook", chi.URLParam(r, "id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the endpoint's most recent deliveries, newest
+// first, ?limit= defaulting to 100.
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.findEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.Queries.ListWebhookDeliveries(r.Context(), db.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Limit:      int32(limit),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list deliveries: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]DeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, newDeliveryResponse(d))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Redeliver sends a delivery's event again as a new delivery, whatever the
+// outcome of the original. The original stays in the log.
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.findEndpoint(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseUUID(w, chi.URLParam(r, "deliveryId"))
+	if !ok {
+		return
+	}
+
+	original, err := h.Queries.GetWebhookDeliveryForEndpoint(r.Context(), db.GetWebhookDeliveryForEndpointParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get delivery: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	delivery, err := h.Queries.CreateWebhookDelivery(r.Context(), db.CreateWebhookDeliveryParams{
+		ID:           newUUID(),
+		EndpointID:   endpoint.ID,
+		EventID:      original.EventID,
+		EventType:    original.EventType,
+		Payload:      original.Payload,
+		RedeliveryOf: original.ID,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create delivery: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := Enqueue(h.EventBus, delivery.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to enqueue delivery: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newDeliveryResponse(delivery)
+	auth.Audit(r.Context(), h.Queries, "webhook.redeliver", "webhook_delivery", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// findEndpoint loads the {id} endpoint of the selected environment,
+// writing the error response when there is none.
+func (h *Handler) findEndpoint(w http.ResponseWriter, r *http.Request) (db.WebhookEndpoint, bool) {
+	id, ok := parseUUID(w, chi.URLParam(r, "id"))
+	if !ok {
+		return db.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := h.Queries.GetWebhookEndpoint(r.Context(), db.GetWebhookEndpointParams{
+		ID:    id,
+		OrgID: auth.OrgID(r.Context()),
+		EnvID: auth.EnvID(r.Context()),
+	})
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return endpoint, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get webhook: %v", err), http.StatusInternalServerError)
+		return endpoint, false
+	}
+	return endpoint, true
+}
+
+func parseUUID(w http.ResponseWriter, s string) (pgtype.UUID, bool) {
+	var id pgtype.UUID
+	if err := id.Scan(s); err != nil {
+		http.Error(w, "Invalid UUID", http.StatusBadRequest)
+		return id, false
+	}
+	return id, true
+}
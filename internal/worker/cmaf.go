@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/OZIOisgood/gamma/internal/playback"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// cmafRenditions are the video outputs of the CMAF encode, matching the
+// HLS variants.
+var cmafRenditions = []struct {
+	name, label               string
+	bitrate, maxrate, bufsize string
+}{
+	{"v0", "[v1out]", "5000k", "5350k", "7500k"},
+	{"v1", "[v2out]", "2800k", "2996k", "4200k"},
+	{"v2", "[v3out]", "1400k", "1498k", "2100k"},
+}
+
+// packageCMAF encodes the upload into workDir with ffmpeg and packages it
+// with Shaka Packager into hlsDir: fMP4 segments encrypted with scheme
+// ("cenc" or "cbcs"), a DASH manifest.mpd and an HLS master.m3u8. The
+// returned function stores the content key and its key ID for the asset.
+func (h *Handler) packageCMAF(ctx context.Context, input, workDir, hlsDir, scheme string, progress *progressReporter) (func(*db.Queries, pgtype.UUID) error, error) {
+	if !keys.ValidScheme(scheme) {
+		return nil, fmt.Errorf("unsupported encryption scheme %q", scheme)
+	}
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+
+	// Keyframes every 2 seconds let the packager cut aligned segments
+	args := []string{"-i", input, "-filter_complex", renditionFilter}
+	for _, r := range cmafRenditions {
+		args = append(args,
+			"-map", r.label, "-c:v", "libx264", "-b:v", r.bitrate, "-maxrate", r.maxrate, "-bufsize", r.bufsize,
+			"-force_key_frames", "expr:gte(t,n_forced*2)", "-an",
+			filepath.Join(workDir, r.name+".mp4"),
+		)
+	}
+	args = append(args,
+		"-map", "a:0", "-c:a", "aac", "-b:a", "128k", "-ac", "2", "-vn",
+		filepath.Join(workDir, "audio.mp4"),
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	if err := progress.run(cmd); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w", err)
+	}
+
+	key, err := keys.NewContentKey()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := keys.NewKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths are relative to hlsDir so the manifests reference segments
+	// relative to themselves
+	var streams []string
+	for _, r := range cmafRenditions {
+		streams = append(streams, fmt.Sprintf(
+			"in=%s,stream=video,init_segment=%s/init.mp4,segment_template=%s/$Number$.m4s,playlist_name=%s.m3u8",
+			filepath.Join(workDir, r.name+".mp4"), r.name, r.name, r.name,
+		))
+	}
+	streams = append(streams, fmt.Sprintf(
+		"in=%s,stream=audio,init_segment=audio/init.mp4,segment_template=audio/$Number$.m4s,playlist_name=audio.m3u8,hls_group_id=audio,hls_name=audio",
+		filepath.Join(workDir, "audio.mp4"),
+	))
+
+	packager := exec.CommandContext(ctx, "packager", append(streams,
+		"--segment_duration", "6",
+		"--enable_raw_key_encryption",
+		"--keys", fmt.Sprintf("key_id=%x:key=%x", keyID, key),
+		"--protection_scheme", scheme,
+		"--protection_systems", "CommonSystem",
+		"--clear_lead", "0",
+		// The playback proxy replaces this with the license endpoint
+		"--hls_key_uri", playback.LicenseURIPlaceholder,
+		"--hls_master_playlist_output", "master.m3u8",
+		"--mpd_output", "manifest.mpd",
+	)...)
+	packager.Dir = hlsDir
+	packager.Stdout = os.Stdout
+	packager.Stderr = os.Stderr
+	if err := packager.Run(); err != nil {
+		return nil, fmt.Errorf("packager failed: %w", err)
+	}
+
+	return h.keySaver(ctx, [][]byte{key}, [][]byte{keyID})
+}
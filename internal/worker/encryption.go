@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/keys"
+	"github.com/OZIOisgood/gamma/internal/playback"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// keyRotator provides ffmpeg's -hls_key_info_file. With rotation enabled it
+// swaps in a new content key every N segments of the first variant; ffmpeg
+// picks it up because of the periodic_rekey flag.
+type keyRotator struct {
+	dir      string
+	infoPath string
+	every    int
+
+	mu   sync.Mutex
+	keys [][]byte
+}
+
+// newKeyRotator writes the first key below dir, which must not be uploaded.
+// every is the rotation interval in segments, 0 disables rotation.
+func newKeyRotator(dir string, every int) (*keyRotator, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key dir: %w", err)
+	}
+
+	k := &keyRotator{
+		dir:      dir,
+		infoPath: filepath.Join(dir, "key.info"),
+		every:    every,
+	}
+	if err := k.rotate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// rotate generates the next key and points the key info file at it. The
+// info file is replaced atomically so ffmpeg never reads a partial one.
+func (k *keyRotator) rotate() error {
+	key, err := keys.NewContentKey()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	index := len(k.keys)
+	keyPath := filepath.Join(k.dir, fmt.Sprintf("key-%d.bin", index))
+	if err := os.WriteFile(keyPath, key, 0600); err != nil {
+		return fmt.Errorf("failed to write content key: %w", err)
+	}
+
+	// Without a third line ffmpeg uses the segment sequence number as IV
+	info := fmt.Sprintf("%s\n%s\n", playback.KeyURI(index), keyPath)
+	tmp := k.infoPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(info), 0600); err != nil {
+		return fmt.Errorf("failed to write key info: %w", err)
+	}
+	if err := os.Rename(tmp, k.infoPath); err != nil {
+		return fmt.Errorf("failed to replace key info: %w", err)
+	}
+
+	k.keys = append(k.keys, key)
+	return nil
+}
+
+// Keys returns the keys used so far, in order.
+func (k *keyRotator) Keys() [][]byte {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([][]byte(nil), k.keys...)
+}
+
+// watch rotates the key as segments of the first variant appear in hlsDir,
+// until ctx is done.
+func (k *keyRotator) watch(ctx context.Context, hlsDir string) {
+	if k.every <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			segments, _ := filepath.Glob(filepath.Join(hlsDir, "v0_segment*.ts"))
+			for len(segments) >= len(k.Keys())*k.every {
+				if err := k.rotate(); err != nil {
+					log.Printf("Failed to rotate content key: %v", err)
+					break
+				}
+			}
+		}
+	}
+}
+
+// keySaver seals content keys with the master key and returns a function
+// storing them for an asset, in order, through the given queries. keyIDs is
+// nil for AES-128 keys.
+func (h *Handler) keySaver(ctx context.Context, contentKeys, keyIDs [][]byte) (func(*db.Queries, pgtype.UUID) error, error) {
+	sealed := make([][]byte, 0, len(contentKeys))
+	for _, key := range contentKeys {
+		s, err := keys.Seal(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal content keys: %w", err)
+		}
+		sealed = append(sealed, s)
+	}
+
+	return func(q *db.Queries, assetID pgtype.UUID) error {
+		for i, key := range sealed {
+			params := db.CreateAssetKeyParams{
+				AssetID:   assetID,
+				KeyIndex:  int32(i),
+				SealedKey: key,
+			}
+			if keyIDs != nil {
+				params.KeyID = keyIDs[i]
+			}
+			if err := q.CreateAssetKey(ctx, params); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
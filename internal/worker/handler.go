@@ -2,33 +2,50 @@ package worker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/OZIOisgood/gamma/internal/db"
 	"github.com/OZIOisgood/gamma/internal/events"
+	"github.com/OZIOisgood/gamma/internal/outbox"
 	"github.com/OZIOisgood/gamma/internal/storage"
+	"github.com/OZIOisgood/gamma/internal/webhooks"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
 )
 
+// renditionFilter scales the input to the 1080p, 720p and 480p variants.
+const renditionFilter = "[0:v]split=3[v1][v2][v3];[v1]scale=w=1920:h=1080:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v1out];[v2]scale=w=1280:h=720:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v2out];[v3]scale=w=854:h=480:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v3out]"
+
 type Handler struct {
+	Pool       *pgxpool.Pool
 	Queries    *db.Queries
 	Storage    *storage.Storage
 	EventBus   *events.EventBus
 	WorkerName string
+	// KeyRotation is the number of segments after which encrypted
+	// renditions switch to a new content key, 0 to use one key per asset.
+	KeyRotation int
 }
 
-func NewHandler(queries *db.Queries, storage *storage.Storage, eventBus *events.EventBus, workerName string) *Handler {
+func NewHandler(pool *pgxpool.Pool, storage *storage.Storage, eventBus *events.EventBus, workerName string) *Handler {
 	return &Handler{
-		Queries:    queries,
+		Pool:       pool,
+		Queries:    db.New(pool),
 		Storage:    storage,
 		EventBus:   eventBus,
 		WorkerName: workerName,
@@ -58,8 +75,14 @@ func (h *Handler) HandleUploadEvent(msg *nats.Msg) {
 		}
 		log.Printf("Processing upload for key: %s", decodedKey)
 
-		if err := h.processVideo(context.Background(), decodedKey); err != nil {
+		err = h.processVideo(context.Background(), decodedKey)
+		if errors.Is(err, errAlreadyHandled) {
+			log.Printf("Skipping %s: already processed or in progress", decodedKey)
+			continue
+		}
+		if err != nil {
 			log.Printf("Failed to process video %s: %v", decodedKey, err)
+			h.failUpload(context.Background(), decodedKey, err)
 		}
 	}
 
@@ -67,19 +90,31 @@ func (h *Handler) HandleUploadEvent(msg *nats.Msg) {
 }
 
 func (h *Handler) processVideo(ctx context.Context, key string) error {
-	// key is like "original/<uploadId>.mp4"
-	parts := strings.Split(key, "/")
-	if len(parts) != 2 {
+	// key is like "original/<orgId>/<uploadId>.mp4", or
+	// "original/<uploadId>.mp4" for uploads made before organizations
+	if !strings.HasPrefix(key, "original/") {
 		return fmt.Errorf("invalid key format: %s", key)
 	}
-	filename := parts[1]
-	uploadIDStr := strings.TrimSuffix(filename, filepath.Ext(filename))
+	filename := path.Base(key)
 
-	// Update status to processing
-	_, err := h.Queries.UpdateUploadStatusByKey(ctx, db.UpdateUploadStatusByKeyParams{
-		S3Key:  key,
-		Status: db.UploadStatusProcessing,
+	// The notification means the file arrived. A redelivered or re-enqueued
+	// notification finds the upload past pending and falls through to the
+	// processing guard below.
+	_, err := h.transition(ctx, key, db.UploadStatusUploaded, []db.UploadStatus{db.UploadStatusPending}, func(q *db.Queries, upload db.Upload) error {
+		return outbox.AddEvent(ctx, q, events.SourceWorker, events.UploadUploadedV1{UploadData: events.NewUploadData(upload)})
 	})
+	if err != nil && !errors.Is(err, errAlreadyHandled) {
+		return fmt.Errorf("failed to update status to uploaded: %w", err)
+	}
+
+	// Update status to processing. Only one worker wins this transition, and
+	// none does once the upload has an asset.
+	upload, err := h.transition(ctx, key, db.UploadStatusProcessing, []db.UploadStatus{db.UploadStatusPending, db.UploadStatusUploaded}, func(q *db.Queries, upload db.Upload) error {
+		return webhooks.Record(ctx, q, events.SourceWorker, events.UploadProcessingV1{UploadData: events.NewUploadData(upload)})
+	})
+	if errors.Is(err, errAlreadyHandled) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update status to processing: %w", err)
 	}
@@ -97,6 +132,46 @@ func (h *Handler) processVideo(ctx context.Context, key string) error {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
 
+	checksum, err := fileSHA256(localInput)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	err = h.Queries.SetUploadChecksum(ctx, db.SetUploadChecksumParams{
+		ID:             upload.ID,
+		ChecksumSha256: pgtype.Text{String: checksum, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store checksum: %w", err)
+	}
+
+	// Reuse the renditions of an identical, already transcoded upload. Only
+	// twins with the visibility new assets get share renditions, so that
+	// sharing them exposes nothing the new asset would not.
+	if upload.Deduplicate {
+		existing, err := h.Queries.GetReadyAssetByChecksum(ctx, db.GetReadyAssetByChecksumParams{
+			OrgID:          upload.OrgID,
+			EnvID:          upload.EnvID,
+			ChecksumSha256: pgtype.Text{String: checksum, Valid: true},
+			Encrypted:      upload.Encrypt,
+			DrmScheme:      upload.DrmScheme,
+			Visibility:     db.AssetVisibilityUnlisted,
+		})
+		if err == nil {
+			log.Printf("Upload %s is a duplicate of asset %s, skipping transcoding", key, uuid.UUID(existing.ID.Bytes).String())
+			// Shared encrypted renditions need the same keys
+			copyKeys := func(q *db.Queries, assetID pgtype.UUID) error {
+				return q.CopyAssetKeys(ctx, db.CopyAssetKeysParams{
+					AssetID:  assetID,
+					SourceID: existing.ID,
+				})
+			}
+			return h.completeUpload(ctx, upload, uuid.New(), existing.HlsRoot, copyKeys)
+		}
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("failed to look up duplicate asset: %w", err)
+		}
+	}
+
 	// Generate Asset ID
 	assetID := uuid.New()
 	hlsDir := filepath.Join(tmpDir, "hls", assetID.String())
@@ -104,14 +179,96 @@ func (h *Handler) processVideo(ctx context.Context, key string) error {
 		return fmt.Errorf("failed to create hls dir: %w", err)
 	}
 
+	// CMAF with Common Encryption, or HLS with TS segments
+	progress := h.newProgressReporter(ctx, upload, localInput)
+	var saveKeys func(*db.Queries, pgtype.UUID) error
+	if upload.DrmScheme.Valid {
+		saveKeys, err = h.packageCMAF(ctx, localInput, filepath.Join(tmpDir, "cmaf"), hlsDir, upload.DrmScheme.String, progress)
+	} else {
+		saveKeys, err = h.transcodeHLS(ctx, localInput, filepath.Join(tmpDir, "keys"), hlsDir, upload.Encrypt, progress)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Upload HLS files
+	orgID := uuid.UUID(upload.OrgID.Bytes).String()
+	err = filepath.Walk(hlsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(filepath.Join(tmpDir, "hls"), path)
+		if err != nil {
+			return err
+		}
+
+		// S3 Key: hls/<orgId>/<assetId>/...
+		s3Key := storage.HLSPrefix(orgID) + filepath.ToSlash(relPath)
+
+		contentType := "application/octet-stream"
+		if strings.HasSuffix(path, ".m3u8") {
+			contentType = "application/vnd.apple.mpegurl"
+		} else if strings.HasSuffix(path, ".ts") {
+			contentType = "video/mp2t"
+		} else if strings.HasSuffix(path, ".mpd") {
+			contentType = "application/dash+xml"
+		} else if strings.HasSuffix(path, ".m4s") || strings.HasSuffix(path, ".mp4") {
+			contentType = "video/mp4"
+		}
+
+		if err := h.Storage.UploadFile(ctx, s3Key, path, contentType); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", s3Key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload HLS files: %w", err)
+	}
+
+	hlsRoot := fmt.Sprintf("%s%s/master.m3u8", storage.HLSPrefix(orgID), assetID.String())
+
+	if err := h.completeUpload(ctx, upload, assetID, hlsRoot, saveKeys); err != nil {
+		// No asset refers to the renditions, drop them
+		prefix := storage.HLSPrefix(orgID) + assetID.String() + "/"
+		if _, delErr := h.Storage.DeletePrefix(ctx, prefix); delErr != nil {
+			log.Printf("Failed to delete renditions %s: %v", prefix, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// transcodeHLS renders the upload into HLS variants in hlsDir. With encrypt
+// the segments are AES-128 encrypted with keys written below keyDir, and
+// the returned function stores them for the asset.
+func (h *Handler) transcodeHLS(ctx context.Context, input, keyDir, hlsDir string, encrypt bool, progress *progressReporter) (func(*db.Queries, pgtype.UUID) error, error) {
 	// Run ffmpeg with multi-quality support
 	// We will generate 3 variants: 1080p, 720p, 480p
 	masterPlaylist := "master.m3u8"
+	hlsFlags := "independent_segments"
+
+	// Encrypted renditions get AES-128 segments. The keys are kept out of
+	// hlsDir so they are never uploaded.
+	var rotator *keyRotator
+	var err error
+	if encrypt {
+		rotator, err = newKeyRotator(keyDir, h.KeyRotation)
+		if err != nil {
+			return nil, err
+		}
+		if h.KeyRotation > 0 {
+			hlsFlags += "+periodic_rekey"
+		}
+	}
 	
 	// Ensure output directories exist for variants
 	cmd := exec.Command("ffmpeg",
-		"-i", localInput,
-		"-filter_complex", "[0:v]split=3[v1][v2][v3];[v1]scale=w=1920:h=1080:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v1out];[v2]scale=w=1280:h=720:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v2out];[v3]scale=w=854:h=480:force_original_aspect_ratio=decrease,pad=ceil(iw/2)*2:ceil(ih/2)*2[v3out]",
+		"-i", input,
+		"-filter_complex", renditionFilter,
 		
 		// 1080p
 		"-map", "[v1out]", "-c:v:0", "libx264", "-b:v:0", "5000k", "-maxrate:v:0", "5350k", "-bufsize:v:0", "7500k",
@@ -128,91 +285,166 @@ func (h *Handler) processVideo(ctx context.Context, key string) error {
 		"-f", "hls",
 		"-hls_time", "10",
 		"-hls_playlist_type", "vod",
-		"-hls_flags", "independent_segments",
+		"-hls_flags", hlsFlags,
 		"-master_pl_name", masterPlaylist,
 		"-hls_segment_filename", filepath.Join(hlsDir, "v%v_segment%03d.ts"),
 		"-var_stream_map", "v:0,a:0 v:1,a:1 v:2,a:2",
-		filepath.Join(hlsDir, "v%v.m3u8"),
 	)
+	if rotator != nil {
+		cmd.Args = append(cmd.Args, "-hls_key_info_file", rotator.infoPath)
+	}
+	cmd.Args = append(cmd.Args, filepath.Join(hlsDir, "v%v.m3u8"))
 	// Capture output for debugging
-	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w", err)
+	if rotator != nil {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		go rotator.watch(watchCtx, hlsDir)
+		err = progress.run(cmd)
+		stopWatching()
+	} else {
+		err = progress.run(cmd)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w", err)
 	}
 
-	// Upload HLS files
-	err = filepath.Walk(hlsDir, func(path string, info os.FileInfo, err error) error {
+	if rotator == nil {
+		return nil, nil
+	}
+	return h.keySaver(ctx, rotator.Keys(), nil)
+}
+
+// completeUpload records the asset for an upload whose renditions are
+// stored under hlsRoot and marks the upload ready. The asset inherits the
+// upload's metadata. For encrypted renditions saveKeys stores the asset's
+// content keys. Everything, including the events announcing the asset, is
+// written in one transaction.
+func (h *Handler) completeUpload(ctx context.Context, upload db.Upload, assetID uuid.UUID, hlsRoot string, saveKeys func(*db.Queries, pgtype.UUID) error) error {
+	key := upload.S3Key
+	uploadIDStr := uuid.UUID(upload.ID.Bytes).String()
+
+	// Create Asset record
+	var pgAssetID pgtype.UUID
+	pgAssetID.Scan(assetID.String())
+
+	err := pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+
+		asset, err := q.CreateAsset(ctx, db.CreateAssetParams{
+			ID:          pgAssetID,
+			OrgID:       upload.OrgID,
+			EnvID:       upload.EnvID,
+			UploadID:    upload.ID,
+			HlsRoot:     hlsRoot,
+			Status:      db.AssetStatusReady,
+			Title:       upload.Title,
+			Description: upload.Description,
+			CreatorID:   upload.CreatorID,
+			ExternalID:  upload.ExternalID,
+			Metadata:    upload.Metadata,
+			Tags:        upload.Tags,
+			Encrypted:   upload.Encrypt,
+			DrmScheme:   upload.DrmScheme,
+		})
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create asset: %w", err)
 		}
-		if info.IsDir() {
-			return nil
+
+		if saveKeys != nil {
+			if err := saveKeys(q, pgAssetID); err != nil {
+				return fmt.Errorf("failed to store content keys: %w", err)
+			}
 		}
 
-		relPath, err := filepath.Rel(filepath.Join(tmpDir, "hls"), path)
+		// Update Upload status to done
+		_, err = q.UpdateUploadStatusByKey(ctx, db.UpdateUploadStatusByKeyParams{
+			S3Key:  key,
+			Status: db.UploadStatusReady,
+		})
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to update upload status to ready: %w", err)
 		}
 
-		// S3 Key: hls/<assetId>/...
-		s3Key := filepath.Join("hls", relPath)
+		// Publish asset processed event
+		return webhooks.Record(ctx, q, events.SourceWorker, events.AssetProcessedV1{
+			AssetID:  assetID.String(),
+			UploadID: uploadIDStr,
+			OrgID:    uuid.UUID(asset.OrgID.Bytes).String(),
+			EnvID:    uuid.UUID(asset.EnvID.Bytes).String(),
+			Status:   string(asset.Status),
+		})
+	})
+	if err != nil {
+		return err
+	}
 
-		contentType := "application/octet-stream"
-		if strings.HasSuffix(path, ".m3u8") {
-			contentType = "application/vnd.apple.mpegurl"
-		} else if strings.HasSuffix(path, ".ts") {
-			contentType = "video/mp2t"
-		}
+	log.Printf("Successfully processed video %s -> asset %s", key, assetID.String())
+	return nil
+}
 
-		if err := h.Storage.UploadFile(ctx, s3Key, path, contentType); err != nil {
-			return fmt.Errorf("failed to upload %s: %w", s3Key, err)
-		}
-		return nil
+// failUpload marks an upload whose processing failed, so it is not left
+// processing until the reconciler flags it.
+func (h *Handler) failUpload(ctx context.Context, key string, cause error) {
+	active := []db.UploadStatus{db.UploadStatusPending, db.UploadStatusUploaded, db.UploadStatusProcessing}
+	_, err := h.transition(ctx, key, db.UploadStatusFailed, active, func(q *db.Queries, upload db.Upload) error {
+		return webhooks.Record(ctx, q, events.SourceWorker, events.UploadFailedV1{UploadData: events.NewUploadData(upload), Error: cause.Error()})
 	})
-	if err != nil {
-		return fmt.Errorf("failed to upload HLS files: %w", err)
+	if err != nil && !errors.Is(err, errAlreadyHandled) {
+		log.Printf("Failed to mark upload %s as failed: %v", key, err)
 	}
+}
 
-	// Create Asset record
-	var pgAssetID pgtype.UUID
-	pgAssetID.Scan(assetID.String())
-	var pgUploadID pgtype.UUID
-	pgUploadID.Scan(uploadIDStr)
+// errAlreadyHandled reports that an upload has left the statuses a
+// transition starts from, or already has an asset, so the job is a duplicate.
+var errAlreadyHandled = errors.New("upload already handled")
 
-	hlsRoot := fmt.Sprintf("hls/%s/master.m3u8", assetID.String())
+// transition moves the upload stored at key to status, provided it is in
+// one of from and has no asset yet, and in the same transaction lets record
+// add the events announcing it. It returns errAlreadyHandled otherwise.
+func (h *Handler) transition(ctx context.Context, key string, status db.UploadStatus, from []db.UploadStatus, record func(*db.Queries, db.Upload) error) (db.Upload, error) {
+	fromStatuses := make([]string, len(from))
+	for i, s := range from {
+		fromStatuses[i] = string(s)
+	}
 
-	_, err = h.Queries.CreateAsset(ctx, db.CreateAssetParams{
-		ID:       pgAssetID,
-		UploadID: pgUploadID,
-		HlsRoot:  hlsRoot,
-		Status:   db.AssetStatusReady,
+	var upload db.Upload
+	err := pgx.BeginFunc(ctx, h.Pool, func(tx pgx.Tx) error {
+		q := h.Queries.WithTx(tx)
+		var err error
+		upload, err = q.TransitionUploadStatusByKey(ctx, db.TransitionUploadStatusByKeyParams{
+			Status:       status,
+			S3Key:        key,
+			FromStatuses: fromStatuses,
+		})
+		if err := transitionError(err); err != nil {
+			return err
+		}
+		return record(q, upload)
 	})
-	if err != nil {
-		return fmt.Errorf("failed to create asset: %w", err)
+	return upload, err
+}
+
+// transitionError maps the error of the conditional status update: no
+// row updated means the upload was not in a status the transition starts
+// from, or already has an asset.
+func transitionError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errAlreadyHandled
 	}
+	return err
+}
 
-	// Update Upload status to done
-	_, err = h.Queries.UpdateUploadStatusByKey(ctx, db.UpdateUploadStatusByKeyParams{
-		S3Key:  key,
-		Status: db.UploadStatusReady,
-	})
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to update upload status to ready: %w", err)
+		return "", err
 	}
+	defer f.Close()
 
-	// Publish asset processed event
-	eventData := map[string]string{
-		"asset_id":  assetID.String(),
-		"upload_id": uploadIDStr,
-		"status":    string(db.AssetStatusReady),
-	}
-	eventBytes, _ := json.Marshal(eventData)
-	if err := h.EventBus.Publish("gamma.assets.processed", eventBytes); err != nil {
-		log.Printf("Failed to publish asset processed event: %v", err)
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
 	}
-
-	log.Printf("Successfully processed video %s -> asset %s", key, assetID.String())
-	return nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestTransitionError(t *testing.T) {
+	errDB := errors.New("connection reset")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"updated", nil, nil},
+		{"no row updated", pgx.ErrNoRows, errAlreadyHandled},
+		{"wrapped no rows", fmt.Errorf("query: %w", pgx.ErrNoRows), errAlreadyHandled},
+		{"other error", errDB, errDB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transitionError(tt.err)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("transitionError(%v) = %v, want nil", tt.err, got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("transitionError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if tt.want != errAlreadyHandled && errors.Is(got, errAlreadyHandled) {
+				t.Errorf("transitionError(%v) reports the upload as handled", tt.err)
+			}
+		})
+	}
+}
+
+// Callers skip duplicate jobs with errors.Is, so errAlreadyHandled must
+// survive wrapping but never match other errors.
+func TestErrAlreadyHandledMatching(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bare", errAlreadyHandled, true},
+		{"wrapped", fmt.Errorf("failed to update status to processing: %w", errAlreadyHandled), true},
+		{"joined", errors.Join(errors.New("cleanup failed"), errAlreadyHandled), true},
+		{"same message", errors.New("upload already handled"), false},
+		{"formatted without wrapping", fmt.Errorf("failed: %v", errAlreadyHandled), false},
+		{"no rows", pgx.ErrNoRows, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, errAlreadyHandled); got != tt.want {
+				t.Errorf("errors.Is(%v, errAlreadyHandled) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessVideoRejectsUnknownKeys(t *testing.T) {
+	// Keys outside original/ fail before the database is touched, and are
+	// not mistaken for duplicates
+	h := &Handler{}
+	for _, key := range []string{"hls/org/asset/master.m3u8", "video.mp4", ""} {
+		err := h.processVideo(context.Background(), key)
+		if err == nil || errors.Is(err, errAlreadyHandled) {
+			t.Errorf("processVideo(%q) = %v, want an invalid key error", key, err)
+		}
+	}
+}
@@ -1,15 +1,38 @@
 package worker
 
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// UploadEventSubject is the subject MinIO publishes object-created
+// notifications to (see MINIO_NOTIFY_NATS_SUBJECT_gamma).
+const UploadEventSubject = "gamma.minio.uploaded"
+
 type MinioEvent struct {
-	Records []struct {
-		EventName string `json:"eventName"`
-		S3        struct {
-			Bucket struct {
-				Name string `json:"name"`
-			} `json:"bucket"`
-			Object struct {
-				Key string `json:"key"`
-			} `json:"object"`
-		} `json:"s3"`
-	} `json:"Records"`
+	Records []MinioRecord `json:"Records"`
+}
+
+type MinioRecord struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key string `json:"key"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// NewUploadEvent builds a message equivalent to the MinIO notification for
+// an object created under key, so a missed upload can be re-enqueued.
+func NewUploadEvent(bucket, key string) ([]byte, error) {
+	var record MinioRecord
+	record.EventName = "s3:ObjectCreated:Put"
+	record.S3.Bucket.Name = bucket
+	// MinIO sends keys URL-encoded, HandleUploadEvent unescapes them.
+	record.S3.Object.Key = url.QueryEscape(key)
+
+	return json.Marshal(MinioEvent{Records: []MinioRecord{record}})
 }
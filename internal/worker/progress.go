@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OZIOisgood/gamma/internal/db"
+	"github.com/OZIOisgood/gamma/internal/events"
+)
+
+// progressStep is the minimum progress, in percent, between two progress
+// events of an upload.
+const progressStep = 5
+
+// progressReporter publishes the transcoding progress of an upload, read
+// from ffmpeg's -progress output.
+type progressReporter struct {
+	bus      *events.EventBus
+	upload   db.Upload
+	duration time.Duration
+}
+
+// newProgressReporter probes the duration of input. Without it progress
+// cannot be computed, and ffmpeg runs without reporting any.
+func (h *Handler) newProgressReporter(ctx context.Context, upload db.Upload, input string) *progressReporter {
+	duration, err := probeDuration(ctx, input)
+	if err != nil {
+		log.Printf("Failed to probe duration of %s, not reporting progress: %v", input, err)
+	}
+	return &progressReporter{bus: h.EventBus, upload: upload, duration: duration}
+}
+
+// run runs an ffmpeg command, publishing its progress.
+func (p *progressReporter) run(cmd *exec.Cmd) error {
+	if p == nil || p.duration <= 0 {
+		cmd.Stdout = os.Stdout
+		return cmd.Run()
+	}
+
+	// -progress is a global option and must precede the inputs
+	cmd.Args = append([]string{cmd.Args[0], "-progress", "pipe:1", "-nostats"}, cmd.Args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	last := 0
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		percent := min(int(time.Duration(us)*time.Microsecond*100/p.duration), 99)
+		if percent >= last+progressStep {
+			last = percent
+			p.publish(percent)
+		}
+	}
+
+	// Keep ffmpeg from blocking on a full pipe should scanning stop early
+	io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	p.publish(100)
+	return nil
+}
+
+func (p *progressReporter) publish(percent int) {
+	err := p.bus.PublishEvent(events.SourceWorker, events.UploadProgressV1{
+		UploadData: events.NewUploadData(p.upload),
+		Percent:    percent,
+	})
+	if err != nil {
+		log.Printf("Failed to publish progress: %v", err)
+	}
+}
+
+// probeDuration returns the duration of a media file.
+func probeDuration(ctx context.Context, input string) (time.Duration, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		input,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", strings.TrimSpace(string(out)), err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -1,4 +1,4 @@
-import { provideHttpClient, withInterceptorsFromDi } from '@angular/common/http';
+import { provideHttpClient, withInterceptors, withInterceptorsFromDi } from '@angular/common/http';
 import { ApplicationConfig, provideBrowserGlobalErrorListeners } from '@angular/core';
 import { provideAnimations } from "@angular/platform-browser/animations";
 import { provideRouter } from '@angular/router';
@@ -6,12 +6,14 @@ import { provideEventPlugins } from "@taiga-ui/event-plugins";
 import { tuiPasswordOptionsProvider } from '@taiga-ui/kit';
 
 import { routes } from './app.routes';
+import { csrfInterceptor } from './core/auth/csrf.interceptor';
+import { environmentInterceptor } from './core/auth/environment.interceptor';
 
 export const appConfig: ApplicationConfig = {
   providers: [
         provideAnimations(),
         provideBrowserGlobalErrorListeners(),
-        provideHttpClient(withInterceptorsFromDi()),
+        provideHttpClient(withInterceptorsFromDi(), withInterceptors([csrfInterceptor, environmentInterceptor])),
     provideRouter(routes),
         provideEventPlugins(),
         tuiPasswordOptionsProvider({
@@ -9,6 +9,17 @@ export interface Upload {
   Status: string;
   CreatedAt: string;
   UpdatedAt: string;
+  ChecksumSha256: string | null;
+  Deduplicate: boolean;
+  Description: string | null;
+  CreatorID: string | null;
+  ExternalID: string | null;
+  Metadata: Record<string, unknown>;
+  Tags: string[];
+  OrgID: string;
+  EnvID: string;
+  Encrypt: boolean;
+  DrmScheme: 'cenc' | 'cbcs' | null;
 }
 
 export interface Asset {
@@ -18,10 +29,32 @@ export interface Asset {
   Status: string;
   CreatedAt: string;
   UpdatedAt: string;
+  Title: string;
+  Description: string | null;
+  CreatorID: string | null;
+  ExternalID: string | null;
+  Metadata: Record<string, unknown>;
+  Tags: string[];
+  Transcript: string | null;
+  OrgID: string;
+  EnvID: string;
+  PromotedFrom: string | null;
+  Visibility: 'public' | 'unlisted' | 'private';
+  AllowedReferrers: string[];
+  TokenTtlSeconds: number;
+  MaxTokens: number;
+  Encrypted: boolean;
+  DrmScheme: 'cenc' | 'cbcs' | null;
 }
 
 export interface PlaylistResponse {
   url: string;
+  // Only set for unlisted and private assets
+  token?: string;
+  expires_at?: string;
+  // Only set for assets encrypted with CENC
+  dash_url?: string;
+  license_url?: string;
 }
 
 @Injectable({
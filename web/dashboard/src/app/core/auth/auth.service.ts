@@ -2,6 +2,21 @@ import { HttpClient } from '@angular/common/http';
 import { Injectable } from '@angular/core';
 import { Observable } from 'rxjs';
 
+export interface Organization {
+  id: string;
+  slug: string;
+  name: string;
+  current: boolean;
+  created_at: string;
+}
+
+export interface Environment {
+  id: string;
+  name: string;
+  settings: Record<string, unknown>;
+  created_at: string;
+}
+
 @Injectable({
   providedIn: 'root'
 })
@@ -12,6 +27,10 @@ export class AuthService {
 
   constructor(private http: HttpClient) {}
 
+  get oidcLoginUrl(): string {
+    return `${this.apiUrl}/oidc/login`;
+  }
+
   get isAuthenticated(): boolean {
     return !!localStorage.getItem('isLoggedIn');
   }
@@ -34,6 +53,68 @@ export class AuthService {
     });
   }
 
+  providers(): Observable<{ password: boolean; oidc: boolean }> {
+    return this.http.get<{ password: boolean; oidc: boolean }>(`${this.apiUrl}/providers`);
+  }
+
+  // completeSso confirms the session cookie set by the OIDC callback and
+  // marks the dashboard as logged in.
+  completeSso(): Observable<any> {
+    return new Observable(observer => {
+      this.http.get(`${this.apiUrl}/me`, {
+        withCredentials: true
+      }).subscribe({
+        next: (res) => {
+          localStorage.setItem('isLoggedIn', 'true');
+          observer.next(res);
+          observer.complete();
+        },
+        error: (err) => {
+          observer.error(err);
+        }
+      });
+    });
+  }
+
+  orgs(): Observable<Organization[]> {
+    return this.http.get<Organization[]>('http://localhost:8080/orgs', {
+      withCredentials: true
+    });
+  }
+
+  // switchOrg selects the organization the session works in. Uploads and
+  // assets are scoped to it.
+  switchOrg(orgId: string): Observable<Organization> {
+    return this.http.post<Organization>(`${this.apiUrl}/org`, { org_id: orgId }, {
+      withCredentials: true
+    });
+  }
+
+  environments(): Observable<Environment[]> {
+    return this.http.get<Environment[]>('http://localhost:8080/environments', {
+      withCredentials: true
+    });
+  }
+
+  logoutEverywhere(): Observable<any> {
+    return new Observable(observer => {
+      this.http.post(`${this.apiUrl}/logout-all`, {}, {
+        withCredentials: true,
+        responseType: 'text'
+      }).subscribe({
+        next: (res) => {
+          localStorage.removeItem('isLoggedIn');
+          localStorage.removeItem('csrfToken');
+          observer.next(res);
+          observer.complete();
+        },
+        error: (err) => {
+          observer.error(err);
+        }
+      });
+    });
+  }
+
   logout(): Observable<any> {
     return new Observable(observer => {
       this.http.post(`${this.apiUrl}/logout`, {}, {
@@ -42,12 +123,14 @@ export class AuthService {
       }).subscribe({
         next: (res) => {
           localStorage.removeItem('isLoggedIn');
+          localStorage.removeItem('csrfToken');
           observer.next(res);
           observer.complete();
         },
         error: (err) => {
           // Even if logout fails on server, we clear local state
           localStorage.removeItem('isLoggedIn');
+          localStorage.removeItem('csrfToken');
           observer.next(err);
           observer.complete();
         }
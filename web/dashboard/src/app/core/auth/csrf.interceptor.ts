@@ -0,0 +1,32 @@
+import { HttpInterceptorFn, HttpResponse } from '@angular/common/http';
+import { tap } from 'rxjs';
+
+const API_URL = 'http://localhost:8080';
+const CSRF_HEADER = 'X-CSRF-Token';
+const CSRF_STORAGE_KEY = 'csrfToken';
+const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS'];
+
+// The API returns the session's CSRF token in the X-CSRF-Token response
+// header and expects it back on every state-changing request, alongside
+// the gamma_csrf cookie.
+export const csrfInterceptor: HttpInterceptorFn = (req, next) => {
+  if (!req.url.startsWith(API_URL)) {
+    return next(req);
+  }
+
+  const token = localStorage.getItem(CSRF_STORAGE_KEY);
+  if (token && !SAFE_METHODS.includes(req.method)) {
+    req = req.clone({ setHeaders: { [CSRF_HEADER]: token } });
+  }
+
+  return next(req).pipe(
+    tap(event => {
+      if (event instanceof HttpResponse) {
+        const latest = event.headers.get(CSRF_HEADER);
+        if (latest) {
+          localStorage.setItem(CSRF_STORAGE_KEY, latest);
+        }
+      }
+    })
+  );
+};
@@ -0,0 +1,16 @@
+import { HttpInterceptorFn } from '@angular/common/http';
+
+const API_URL = 'http://localhost:8080';
+const ENVIRONMENT_HEADER = 'X-Gamma-Environment';
+export const ENVIRONMENT_STORAGE_KEY = 'environment';
+
+// Sends the environment picked in the navbar with every API request. The
+// API falls back to prod when the header is missing.
+export const environmentInterceptor: HttpInterceptorFn = (req, next) => {
+  const environment = localStorage.getItem(ENVIRONMENT_STORAGE_KEY);
+  if (!req.url.startsWith(API_URL) || !environment) {
+    return next(req);
+  }
+
+  return next(req.clone({ setHeaders: { [ENVIRONMENT_HEADER]: environment } }));
+};
@@ -1,7 +1,8 @@
-import { Component, inject } from '@angular/core';
+import { Component, inject, OnInit } from '@angular/core';
 import { Router, RouterLink } from '@angular/router';
 import { TuiButton } from '@taiga-ui/core';
-import { AuthService } from '../auth/auth.service';
+import { AuthService, Environment, Organization } from '../auth/auth.service';
+import { ENVIRONMENT_STORAGE_KEY } from '../auth/environment.interceptor';
 import { UploadUiService } from '../services/upload-ui.service';
 
 @Component({
@@ -11,11 +12,57 @@ import { UploadUiService } from '../services/upload-ui.service';
   templateUrl: './navbar.component.html',
   styleUrls: ['./navbar.component.scss'],
 })
-export class NavbarComponent {
+export class NavbarComponent implements OnInit {
   private readonly authService = inject(AuthService);
   private readonly router = inject(Router);
   private readonly uploadUiService = inject(UploadUiService);
 
+  orgs: Organization[] = [];
+  currentOrgId = '';
+  environments: Environment[] = [];
+  currentEnvironment = localStorage.getItem(ENVIRONMENT_STORAGE_KEY) ?? 'prod';
+
+  ngOnInit(): void {
+    this.authService.orgs().subscribe({
+      next: (orgs) => {
+        this.orgs = orgs;
+        this.currentOrgId = orgs.find(o => o.current)?.id ?? '';
+      },
+      error: (err) => {
+        console.error('Failed to load organizations', err);
+      }
+    });
+
+    this.authService.environments().subscribe({
+      next: (environments) => {
+        this.environments = environments;
+      },
+      error: (err) => {
+        console.error('Failed to load environments', err);
+      }
+    });
+  }
+
+  switchEnvironment(event: Event): void {
+    const name = (event.target as HTMLSelectElement).value;
+    localStorage.setItem(ENVIRONMENT_STORAGE_KEY, name);
+    // Reload so every view fetches the new environment's data
+    window.location.reload();
+  }
+
+  switchOrg(event: Event): void {
+    const orgId = (event.target as HTMLSelectElement).value;
+    this.authService.switchOrg(orgId).subscribe({
+      next: () => {
+        // Reload so every view fetches the new organization's data
+        window.location.reload();
+      },
+      error: (err) => {
+        console.error('Failed to switch organization', err);
+      }
+    });
+  }
+
   logout(): void {
     this.authService.logout().subscribe({
       next: () => {
@@ -29,6 +76,17 @@ export class NavbarComponent {
     });
   }
 
+  logoutEverywhere(): void {
+    this.authService.logoutEverywhere().subscribe({
+      next: () => {
+        this.router.navigate(['/login']);
+      },
+      error: (err) => {
+        console.error('Logout everywhere failed', err);
+      }
+    });
+  }
+
   openUpload(): void {
     this.uploadUiService.open();
   }
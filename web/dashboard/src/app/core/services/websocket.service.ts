@@ -1,9 +1,86 @@
 import { Injectable } from '@angular/core';
 import { Subject } from 'rxjs';
 
-export interface WsMessage {
+/** Envelope of every event, in the CloudEvents 1.0 JSON format. */
+export interface CloudEvent<T = unknown> {
+  specversion: '1.0';
+  id: string;
+  source: string;
   type: string;
-  data: any;
+  subject?: string;
+  time: string;
+  datacontenttype: string;
+  data: T;
+  /** Sequence in the GAMMA_ASSETS stream, used to resume after reconnecting. */
+  streamseq?: number;
+}
+
+/** Event types; the schemas are served at /events/schemas/{type}. */
+export const EventTypes = {
+  UploadCreatedV1: 'gamma.upload.created.v1',
+  UploadUploadedV1: 'gamma.upload.uploaded.v1',
+  UploadProcessingV1: 'gamma.upload.processing.v1',
+  UploadProgressV1: 'gamma.upload.progress.v1',
+  UploadFailedV1: 'gamma.upload.failed.v1',
+  AssetProcessedV1: 'gamma.asset.processed.v1',
+  AssetDeletedV1: 'gamma.asset.deleted.v1',
+} as const;
+
+export interface UploadData {
+  upload_id: string;
+  org_id: string;
+  env_id: string;
+  status: string;
+}
+
+export interface UploadCreatedV1 extends UploadData {
+  title: string;
+}
+
+export interface UploadProgressV1 extends UploadData {
+  percent: number;
+}
+
+export interface UploadFailedV1 extends UploadData {
+  error: string;
+}
+
+export interface AssetProcessedV1 {
+  asset_id: string;
+  upload_id: string;
+  org_id: string;
+  env_id: string;
+  status: string;
+}
+
+export interface AssetDeletedV1 {
+  asset_id: string;
+  upload_id: string;
+  org_id: string;
+  env_id: string;
+}
+
+/** Changes what the socket receives; see the WebSockets section of the README. */
+export interface SubscriptionRequest {
+  action: 'subscribe' | 'unsubscribe';
+  asset_ids?: string[];
+  upload_ids?: string[];
+  types?: string[];
+  resume_from?: number;
+}
+
+interface SubscriptionResponse {
+  action: string;
+  asset_ids: string[];
+  upload_ids: string[];
+  types: string[];
+  error?: string;
+}
+
+/** Sent when events were dropped before reaching the socket. */
+interface ResyncMessage {
+  action: 'resync';
+  dropped: number;
 }
 
 @Injectable({
@@ -11,24 +88,82 @@ export interface WsMessage {
 })
 export class WebsocketService {
   private socket: WebSocket | null = null;
-  private messagesSubject = new Subject<WsMessage>();
+  private messagesSubject = new Subject<CloudEvent>();
   public messages$ = this.messagesSubject.asObservable();
 
+  // Replayed after reconnecting, since subscriptions belong to a socket
+  private subscription = { asset_ids: new Set<string>(), upload_ids: new Set<string>(), types: new Set<string>() };
+  // streamseq of the last event received, to replay what was missed
+  private lastSeq: number | null = null;
+
   constructor() {
     this.connect();
   }
 
+  subscribe(req: Omit<SubscriptionRequest, 'action'>) {
+    req.asset_ids?.forEach(id => this.subscription.asset_ids.add(id));
+    req.upload_ids?.forEach(id => this.subscription.upload_ids.add(id));
+    req.types?.forEach(t => this.subscription.types.add(t));
+    this.sendRequest({ action: 'subscribe', ...req });
+  }
+
+  unsubscribe(req: Omit<SubscriptionRequest, 'action'>) {
+    req.asset_ids?.forEach(id => this.subscription.asset_ids.delete(id));
+    req.upload_ids?.forEach(id => this.subscription.upload_ids.delete(id));
+    req.types?.forEach(t => this.subscription.types.delete(t));
+    this.sendRequest({ action: 'unsubscribe', ...req });
+  }
+
+  private sendRequest(req: SubscriptionRequest) {
+    if (this.socket?.readyState === WebSocket.OPEN) {
+      this.socket.send(JSON.stringify(req));
+    }
+  }
+
   private connect() {
+    // The session cookie authenticates the upgrade
     this.socket = new WebSocket('ws://localhost:8080/ws');
 
     this.socket.onopen = () => {
       console.log('WebSocket connected');
+      const { asset_ids, upload_ids, types } = this.subscription;
+      if (asset_ids.size || upload_ids.size || types.size) {
+        this.sendRequest({
+          action: 'subscribe',
+          asset_ids: [...asset_ids],
+          upload_ids: [...upload_ids],
+          types: [...types],
+          ...(this.lastSeq !== null ? { resume_from: this.lastSeq } : {}),
+        });
+      }
     };
 
     this.socket.onmessage = (event) => {
       try {
-        const message: WsMessage = JSON.parse(event.data);
-        this.messagesSubject.next(message);
+        const message = JSON.parse(event.data);
+        if (message.action === 'resync') {
+          // Replay what was dropped; events already received are skipped
+          console.warn(`WebSocket dropped ${(message as ResyncMessage).dropped} events, resuming`);
+          if (this.lastSeq !== null) {
+            this.sendRequest({ action: 'subscribe', resume_from: this.lastSeq });
+          }
+          return;
+        }
+        if ('action' in message) {
+          const resp = message as SubscriptionResponse;
+          if (resp.error) {
+            console.error('WebSocket subscription rejected:', resp.error);
+          }
+          return;
+        }
+        if (message.specversion !== '1.0') {
+          console.warn('Ignoring WebSocket message with unsupported specversion', message.specversion);
+          return;
+        }
+        if (message.streamseq) {
+          this.lastSeq = message.streamseq;
+        }
+        this.messagesSubject.next(message as CloudEvent);
       } catch (e) {
         console.error('Failed to parse WebSocket message', e);
       }
@@ -8,7 +8,7 @@ import { TuiBadge, TuiStatus } from '@taiga-ui/kit';
 import { BehaviorSubject, map, Subscription, switchMap } from 'rxjs';
 import { AssetsService, Upload } from '../../core/assets/assets.service';
 import { NavbarComponent } from '../../core/navbar/navbar.component';
-import { WebsocketService } from '../../core/services/websocket.service';
+import { EventTypes, WebsocketService } from '../../core/services/websocket.service';
 import { UploadDrawerComponent } from '../upload/upload-drawer/upload-drawer.component';
 import { UploadService } from '../upload/upload.service';
 
@@ -54,9 +54,13 @@ export class DashboardComponent implements OnInit, OnDestroy {
 
   @ViewChild('fileInput') fileInput!: ElementRef<HTMLInputElement>;
 
+  // Every status change shows in the list; progress alone does not
+  private readonly refreshTypes: string[] = Object.values(EventTypes).filter(t => t !== EventTypes.UploadProgressV1);
+
   ngOnInit() {
+    this.websocketService.subscribe({ types: this.refreshTypes });
     this.wsSubscription = this.websocketService.messages$.subscribe(msg => {
-      if (msg.type === 'asset_processed') {
+      if (this.refreshTypes.includes(msg.type)) {
         this.refresh$.next();
       }
     });
@@ -64,6 +68,7 @@ export class DashboardComponent implements OnInit, OnDestroy {
 
   ngOnDestroy() {
     this.wsSubscription?.unsubscribe();
+    this.websocketService.unsubscribe({ types: this.refreshTypes });
   }
 
   getShortId(id: string): string {
@@ -74,6 +79,7 @@ export class DashboardComponent implements OnInit, OnDestroy {
     switch (status) {
       case 'completed':
       case 'ready': return 'success';
+      case 'uploaded':
       case 'processing': return 'info';
       case 'pending': return 'warning';
       case 'failed': return 'error';
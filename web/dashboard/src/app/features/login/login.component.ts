@@ -1,7 +1,7 @@
 import { CommonModule } from '@angular/common';
-import { Component } from '@angular/core';
+import { Component, OnInit } from '@angular/core';
 import { FormControl, FormGroup, ReactiveFormsModule, Validators } from '@angular/forms';
-import { Router } from '@angular/router';
+import { ActivatedRoute, Router } from '@angular/router';
 import { TuiIcon, TuiTextfield } from '@taiga-ui/core';
 import { TuiPassword } from '@taiga-ui/kit';
 import { AuthService } from '../../core/auth/auth.service';
@@ -19,7 +19,7 @@ import { AuthService } from '../../core/auth/auth.service';
   templateUrl: './login.component.html',
   styleUrls: ['./login.component.less']
 })
-export class LoginComponent {
+export class LoginComponent implements OnInit {
   loginForm = new FormGroup({
     username: new FormControl('', [Validators.required]),
     password: new FormControl('', [Validators.required])
@@ -27,12 +27,44 @@ export class LoginComponent {
 
   loading = false;
   error = '';
+  oidcEnabled = false;
 
   constructor(
     private authService: AuthService,
-    private router: Router
+    private router: Router,
+    private route: ActivatedRoute
   ) {}
 
+  get oidcLoginUrl(): string {
+    return this.authService.oidcLoginUrl;
+  }
+
+  ngOnInit() {
+    this.authService.providers().subscribe({
+      next: (providers) => this.oidcEnabled = providers.oidc,
+      error: (err) => console.error(err)
+    });
+
+    // The OIDC callback redirects back here with ?sso=ok or ?sso=error
+    const params = this.route.snapshot.queryParamMap;
+    if (params.get('sso') === 'ok') {
+      this.loading = true;
+      this.authService.completeSso().subscribe({
+        next: () => {
+          this.loading = false;
+          this.router.navigate(['/dashboard']);
+        },
+        error: (err) => {
+          this.loading = false;
+          this.error = 'Single sign-on failed';
+          console.error(err);
+        }
+      });
+    } else if (params.get('sso') === 'error') {
+      this.error = `Single sign-on failed: ${params.get('error') ?? 'unknown error'}`;
+    }
+  }
+
   onSubmit() {
     if (this.loginForm.valid) {
       this.loading = true;